@@ -15,15 +15,24 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
-	"regexp"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+var decoderVar = flag.String("decoder", "", "Name of a package level *convreq.Decoder variable to decode input with, rather than the default Decoder")
+
 func main() {
 	flag.Parse()
 	if err := run(); err != nil {
@@ -31,48 +40,220 @@ func main() {
 	}
 }
 
-var (
-	// vi: (
-	defineRe = regexp.MustCompile(`(?m)^func (?:\([a-z]+ ([^)]+)\) )?([A-Za-z0-9]+)\(.*http\.Request`) // vi: )
+type paramKind int
+
+const (
+	paramContext paramKind = iota
+	paramRequest
+	paramResponseWriter
+	paramMultipartStream
+	paramJSONStream
+	// paramDecoded is used for all types that are decoded by a function internal.Decode<typ>(r).
+	paramDecoded
+	paramGet
+	paramHeaders
+	paramCookies
+	paramForm
+	paramJSON
+	paramBody
+	paramTagged
 )
 
+type param struct {
+	kind paramKind
+	// typ is the name of the type, without the * if ptr is set.
+	typ string
+	ptr bool
+	// method is the method a paramForm is decoded for, or empty if it's decoded for all of formMethods.
+	method string
+}
+
+// formSuffixes maps suffixes of form input types to the method they're decoded for. See convreq.Wrap.
+var formSuffixes = map[string]string{
+	"Post":   "POST",
+	"Put":    "PUT",
+	"Patch":  "PATCH",
+	"Delete": "DELETE",
+	"Form":   "",
+}
+
+// formMethods are the methods for which ...Form inputs are decoded.
+var formMethods = []string{"POST", "PUT", "PATCH", "DELETE"}
+
 type handler struct {
 	name   string
 	ontype string
+	params []param
 }
 
+// sourceTags are the struct tags that make a struct a tagged input struct. See internal.IsTagged.
+var sourceTags = []string{"path", "query", "header", "cookie", "form", "body"}
+
 func run() error {
-	var handlers []handler
+	fset := token.NewFileSet()
+	var files []*ast.File
 	for _, fn := range flag.Args() {
-		code, err := ioutil.ReadFile(fn)
+		f, err := parser.ParseFile(fset, fn, nil, 0)
 		if err != nil {
 			return err
 		}
-		for _, m := range defineRe.FindAllStringSubmatch(string(code), -1) {
-			handlers = append(handlers, handler{
-				name:   m[2],
-				ontype: m[1],
-			})
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("usage: %s file.go...", os.Args[0])
+	}
+	structs := map[string]*ast.StructType{}
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if ts, ok := n.(*ast.TypeSpec); ok {
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					structs[ts.Name.Name] = st
+				}
+			}
+			return true
+		})
+	}
+	var handlers []handler
+	for _, f := range files {
+		for _, d := range f.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || !isHandler(fd) {
+				continue
+			}
+			h, err := newHandler(fd, structs)
+			if err != nil {
+				return fmt.Errorf("%s: %v", fset.Position(fd.Pos()), err)
+			}
+			handlers = append(handlers, h)
 		}
 	}
-	generate(os.Stdout, handlers)
+	generate(os.Stdout, files[0].Name.Name, handlers)
 	return nil
 }
 
-func generate(w io.Writer, handlers []handler) {
-	fmt.Fprintf(w, "package main\n")
-	fmt.Fprintf(w, "\n")
-	fmt.Fprintf(w, "import (\n")
-	fmt.Fprintf(w, "\t%q\n", "fmt")
-	fmt.Fprintf(w, "\t%q\n", "net/http")
-	fmt.Fprintf(w, "\t%q\n", "net/url")
-	fmt.Fprintf(w, "\n")
-	fmt.Fprintf(w, "\t%q\n", "github.com/Jille/convreq")
-	fmt.Fprintf(w, "\t%q\n", "github.com/Jille/convreq/genapi")
-	fmt.Fprintf(w, "\t%q\n", "github.com/Jille/convreq/internal")
-	fmt.Fprintf(w, "\t%q\n", "github.com/Jille/convreq/respond")
-	fmt.Fprintf(w, "\t%q\n", "github.com/gorilla/mux")
-	fmt.Fprintf(w, ")\n")
+// isHandler returns whether fd looks like a request handler: it takes a *http.Request and returns a single value.
+func isHandler(fd *ast.FuncDecl) bool {
+	if fd.Type.Results == nil || len(fd.Type.Results.List) != 1 || len(fd.Type.Results.List[0].Names) > 1 {
+		return false
+	}
+	for _, f := range fd.Type.Params.List {
+		if types.ExprString(f.Type) == "*http.Request" {
+			return true
+		}
+	}
+	return false
+}
+
+func newHandler(fd *ast.FuncDecl, structs map[string]*ast.StructType) (handler, error) {
+	h := handler{
+		name: fd.Name.Name,
+	}
+	if fd.Recv != nil {
+		h.ontype = types.ExprString(fd.Recv.List[0].Type)
+	}
+	for _, f := range fd.Type.Params.List {
+		p, err := newParam(f.Type, structs)
+		if err != nil {
+			return handler{}, fmt.Errorf("%s: %v", h.name, err)
+		}
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; n > i; i++ {
+			h.params = append(h.params, p)
+		}
+	}
+	return h, nil
+}
+
+func newParam(e ast.Expr, structs map[string]*ast.StructType) (param, error) {
+	switch types.ExprString(e) {
+	case "context.Context":
+		return param{kind: paramContext}, nil
+	case "*http.Request":
+		return param{kind: paramRequest}, nil
+	case "http.ResponseWriter":
+		return param{kind: paramResponseWriter}, nil
+	case "*convreq.MultipartStream":
+		return param{kind: paramMultipartStream}, nil
+	case "convreq.LastEventID", "convreq.Page", "convreq.Patch", "convreq.MergePatch", "convreq.JSONPatch":
+		return param{kind: paramDecoded, typ: strings.TrimPrefix(types.ExprString(e), "convreq.")}, nil
+	}
+	if se, ok := e.(*ast.StarExpr); ok {
+		if ie, ok := se.X.(*ast.IndexExpr); ok && types.ExprString(ie.X) == "convreq.JSONStream" {
+			return param{kind: paramJSONStream, typ: types.ExprString(ie.Index)}, nil
+		}
+	}
+	p := param{}
+	if se, ok := e.(*ast.StarExpr); ok {
+		p.ptr = true
+		e = se.X
+	}
+	id, ok := e.(*ast.Ident)
+	if !ok {
+		return param{}, fmt.Errorf("don't know how to produce %s", types.ExprString(e))
+	}
+	p.typ = id.Name
+	if p.ptr {
+		for suffix, m := range formSuffixes {
+			if strings.HasSuffix(p.typ, suffix) {
+				p.kind = paramForm
+				p.method = m
+				return p, nil
+			}
+		}
+	}
+	switch {
+	case !p.ptr && strings.HasSuffix(p.typ, "Get"):
+		p.kind = paramGet
+	case !p.ptr && strings.HasSuffix(p.typ, "Headers"):
+		p.kind = paramHeaders
+	case !p.ptr && strings.HasSuffix(p.typ, "Cookies"):
+		p.kind = paramCookies
+	case strings.HasSuffix(p.typ, "JSON"):
+		p.kind = paramJSON
+	case strings.HasSuffix(p.typ, "Body"):
+		p.kind = paramBody
+	case isTagged(structs[p.typ]):
+		p.kind = paramTagged
+	default:
+		return param{}, fmt.Errorf("don't know how to produce %s", types.ExprString(e))
+	}
+	return p, nil
+}
+
+// isTagged returns whether st is a tagged input struct.
+func isTagged(st *ast.StructType) bool {
+	if st == nil {
+		return false
+	}
+	for _, f := range st.Fields.List {
+		if f.Tag == nil {
+			continue
+		}
+		tag, err := strconv.Unquote(f.Tag.Value)
+		if err != nil {
+			continue
+		}
+		for _, src := range sourceTags {
+			if _, ok := reflect.StructTag(tag).Lookup(src); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func generate(w io.Writer, pkg string, handlers []handler) {
+	var buf bytes.Buffer
+	imports := map[string]bool{
+		"net/http":                          true,
+		"github.com/Jille/convreq":          true,
+		"github.com/Jille/convreq/genapi":   true,
+		"github.com/Jille/convreq/internal": true,
+	}
+	getTypes := map[string]bool{}
 
 	for _, h := range handlers {
 		base := h.name
@@ -82,35 +263,181 @@ func generate(w io.Writer, handlers []handler) {
 			onstruct = "(t " + h.ontype + ") "
 			prefix = "t."
 		}
-		fmt.Fprintf(w, "\n")
-		fmt.Fprintf(w, "func %scrq%s(w http.ResponseWriter, r *http.Request) {\n", onstruct, base)
-		fmt.Fprintf(w, "\thr := %s_crqInternal%s(w, r)\n", prefix, base)
-		fmt.Fprintf(w, "\tinternal.DoRespond(w, r, hr)\n")
-		fmt.Fprintf(w, "}\n")
-		fmt.Fprintf(w, "\n")
-		fmt.Fprintf(w, "func %s_crqInternal%s(w http.ResponseWriter, r *http.Request) (resp convreq.HttpResponse) {\n", onstruct, base)
-		fmt.Fprintf(w, "\tdefer genapi.PanicHandler(&resp)()\n")
-		fmt.Fprintf(w, "\tvar get %sGet\n", base)
-		fmt.Fprintf(w, "\tif err := internal.DecodeGet(r, &get); err != nil {\n")
-		fmt.Fprintf(w, "\t\treturn respond.BadRequest(err.Error())\n")
-		fmt.Fprintf(w, "\t}\n")
-		fmt.Fprintf(w, "\tvar postptr *%sPost\n", base)
-		fmt.Fprintf(w, "\tif r.Method == %q {\n", "POST")
-		fmt.Fprintf(w, "\t\tvar post %sPost\n", base)
-		fmt.Fprintf(w, "\t\tif err := internal.DecodePost(r, &post); err != nil {\n")
-		fmt.Fprintf(w, "\t\t\treturn respond.BadRequest(err.Error())\n")
-		fmt.Fprintf(w, "\t\t}\n")
-		fmt.Fprintf(w, "\t\tpostptr = &post\n")
-		fmt.Fprintf(w, "\t}\n")
-		fmt.Fprintf(w, "\treturn %s%s(r.Context(), r, get, postptr)\n", prefix, base)
-		fmt.Fprintf(w, "}\n")
-		fmt.Fprintf(w, "\n")
-		fmt.Fprintf(w, "func (g %sGet) URL(r *mux.Route) *url.URL {\n", base)
-		fmt.Fprintf(w, "\tu, err := convreq.URL(r, g)\n")
-		fmt.Fprintf(w, "\tif err != nil {\n")
-		fmt.Fprintf(w, "\t\tpanic(fmt.Errorf(\"failed to construct URL: %%v\", err))\n")
-		fmt.Fprintf(w, "\t}\n")
-		fmt.Fprintf(w, "\treturn u\n")
-		fmt.Fprintf(w, "}\n")
+		fmt.Fprintf(&buf, "\n")
+		fmt.Fprintf(&buf, "func %scrq%s(w http.ResponseWriter, r *http.Request) {\n", onstruct, base)
+		fmt.Fprintf(&buf, "\thr := %s_crqInternal%s(w, r)\n", prefix, base)
+		fmt.Fprintf(&buf, "\tinternal.DoRespond(w, r, hr)\n")
+		fmt.Fprintf(&buf, "}\n")
+		fmt.Fprintf(&buf, "\n")
+		fmt.Fprintf(&buf, "func %s_crqInternal%s(w http.ResponseWriter, r *http.Request) (resp convreq.HttpResponse) {\n", onstruct, base)
+		fmt.Fprintf(&buf, "\tdefer genapi.RecoverPanic(r, &resp)()\n")
+		if *decoderVar != "" {
+			fmt.Fprintf(&buf, "\tr = r.WithContext(convreq.ContextWithDecoder(r.Context(), %s))\n", *decoderVar)
+		}
+		generateMethodCheck(&buf, h)
+		args := make([]string, len(h.params))
+		for i, p := range h.params {
+			v := fmt.Sprintf("p%d", i)
+			args[i] = v
+			switch p.kind {
+			case paramContext:
+				args[i] = "r.Context()"
+			case paramRequest:
+				args[i] = "r"
+			case paramResponseWriter:
+				args[i] = "w"
+			case paramMultipartStream:
+				fmt.Fprintf(&buf, "\t%s, err := internal.NewMultipartStream(r)\n", v)
+				fmt.Fprintf(&buf, "\tif err != nil {\n")
+				fmt.Fprintf(&buf, "\t\treturn genapi.DecodeFailed(err)\n")
+				fmt.Fprintf(&buf, "\t}\n")
+			case paramJSONStream:
+				fmt.Fprintf(&buf, "\t%s, err := convreq.NewJSONStream[%s](r)\n", v, p.typ)
+				fmt.Fprintf(&buf, "\tif err != nil {\n")
+				fmt.Fprintf(&buf, "\t\treturn genapi.DecodeFailed(err)\n")
+				fmt.Fprintf(&buf, "\t}\n")
+			case paramDecoded:
+				fmt.Fprintf(&buf, "\t%s, err := internal.Decode%s(r)\n", v, p.typ)
+				fmt.Fprintf(&buf, "\tif err != nil {\n")
+				fmt.Fprintf(&buf, "\t\treturn genapi.DecodeFailed(err)\n")
+				fmt.Fprintf(&buf, "\t}\n")
+			case paramGet:
+				getTypes[p.typ] = true
+				fmt.Fprintf(&buf, "\tvar %s %s\n", v, p.typ)
+				generateDecode(&buf, "\t", "&"+v, "internal.DecodeGet")
+			case paramHeaders:
+				fmt.Fprintf(&buf, "\tvar %s %s\n", v, p.typ)
+				generateDecode(&buf, "\t", "&"+v, "internal.DecodeHeaders")
+			case paramCookies:
+				fmt.Fprintf(&buf, "\tvar %s %s\n", v, p.typ)
+				generateDecode(&buf, "\t", "&"+v, "internal.DecodeCookies")
+			case paramForm:
+				fmt.Fprintf(&buf, "\tvar %s *%s\n", v, p.typ)
+				if p.method != "" {
+					fmt.Fprintf(&buf, "\tif r.Method == %q {\n", p.method)
+				} else {
+					fmt.Fprintf(&buf, "\tswitch r.Method {\n")
+					fmt.Fprintf(&buf, "\tcase %s:\n", quoteAll(formMethods))
+				}
+				fmt.Fprintf(&buf, "\t\t%s = new(%s)\n", v, p.typ)
+				generateDecode(&buf, "\t\t", v, "internal.DecodeForm")
+				fmt.Fprintf(&buf, "\t}\n")
+			case paramJSON:
+				fmt.Fprintf(&buf, "\tvar %s %s\n", v, p.typ)
+				generateDecode(&buf, "\t", "&"+v, "internal.DecodeJSON")
+			case paramBody:
+				fmt.Fprintf(&buf, "\tvar %s %s\n", v, p.typ)
+				fmt.Fprintf(&buf, "\tif err := internal.DecodeBody(r, &%s, nil); err != nil {\n", v)
+				generateDecodeCheck(&buf, "\t", "&"+v)
+			case paramTagged:
+				fmt.Fprintf(&buf, "\tvar %s %s\n", v, p.typ)
+				generateDecode(&buf, "\t", "&"+v, "internal.DecodeTagged")
+			}
+			if p.ptr && p.kind != paramForm {
+				args[i] = "&" + v
+			}
+		}
+		fmt.Fprintf(&buf, "\treturn %s%s(%s)\n", prefix, base, strings.Join(args, ", "))
+		fmt.Fprintf(&buf, "}\n")
+	}
+
+	if bytes.Contains(buf.Bytes(), []byte("respond.")) {
+		imports["github.com/Jille/convreq/respond"] = true
+	}
+	if bytes.Contains(buf.Bytes(), []byte("fmt.")) {
+		imports["fmt"] = true
+	}
+
+	var gets []string
+	for g := range getTypes {
+		gets = append(gets, g)
+	}
+	sort.Strings(gets)
+	for _, g := range gets {
+		imports["fmt"] = true
+		imports["net/url"] = true
+		imports["github.com/gorilla/mux"] = true
+		fmt.Fprintf(&buf, "\n")
+		fmt.Fprintf(&buf, "func (g %s) URL(r *mux.Route) *url.URL {\n", g)
+		fmt.Fprintf(&buf, "\tu, err := convreq.URL(r, g)\n")
+		fmt.Fprintf(&buf, "\tif err != nil {\n")
+		fmt.Fprintf(&buf, "\t\tpanic(fmt.Errorf(\"failed to construct URL: %%v\", err))\n")
+		fmt.Fprintf(&buf, "\t}\n")
+		fmt.Fprintf(&buf, "\treturn u\n")
+		fmt.Fprintf(&buf, "}\n")
+	}
+
+	fmt.Fprintf(w, "package %s\n", pkg)
+	fmt.Fprintf(w, "\n")
+	fmt.Fprintf(w, "import (\n")
+	var std, other []string
+	for imp := range imports {
+		if strings.Contains(imp, ".") {
+			other = append(other, imp)
+		} else {
+			std = append(std, imp)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	for _, imp := range std {
+		fmt.Fprintf(w, "\t%q\n", imp)
+	}
+	fmt.Fprintf(w, "\n")
+	for _, imp := range other {
+		fmt.Fprintf(w, "\t%q\n", imp)
+	}
+	fmt.Fprintf(w, ")\n")
+	w.Write(buf.Bytes())
+}
+
+// generateMethodCheck writes code that responds with a 405 if the handler has ...Put, ...Patch or ...Delete inputs, but none for the request's method.
+// GET, HEAD and OPTIONS are always allowed, and ...Post inputs alone don't restrict the methods. See convreq.Wrap.
+func generateMethodCheck(w io.Writer, h handler) {
+	methods := map[string]bool{}
+	restricted := false
+	for _, p := range h.params {
+		if p.kind == paramForm && p.method != "" {
+			methods[p.method] = true
+			if p.method != "POST" {
+				restricted = true
+			}
+		}
+	}
+	if !restricted {
+		return
+	}
+	allow := []string{"GET", "HEAD", "OPTIONS"}
+	for m := range methods {
+		allow = append(allow, m)
+	}
+	sort.Strings(allow[3:])
+	fmt.Fprintf(w, "\tswitch r.Method {\n")
+	fmt.Fprintf(w, "\tcase %s:\n", quoteAll(allow))
+	fmt.Fprintf(w, "\tdefault:\n")
+	fmt.Fprintf(w, "\t\treturn respond.WithHeader(respond.MethodNotAllowed(fmt.Sprintf(\"method %%s not allowed\", r.Method)), \"Allow\", %q)\n", strings.Join(allow, ", "))
+	fmt.Fprintf(w, "\t}\n")
+}
+
+func quoteAll(s []string) string {
+	q := make([]string, len(s))
+	for i, v := range s {
+		q[i] = strconv.Quote(v)
 	}
+	return strings.Join(q, ", ")
+}
+
+// generateDecode writes code that decodes into ptr with decodeFunc and validates the result, returning an error response if that fails.
+func generateDecode(w io.Writer, indent, ptr, decodeFunc string) {
+	fmt.Fprintf(w, "%sif err := %s(r, %s); err != nil {\n", indent, decodeFunc, ptr)
+	generateDecodeCheck(w, indent, ptr)
+}
+
+// generateDecodeCheck writes the body of the `if err := ...; err != nil {` statement written by the caller, and validates the value at ptr.
+func generateDecodeCheck(w io.Writer, indent, ptr string) {
+	fmt.Fprintf(w, "%s\treturn genapi.DecodeFailed(err)\n", indent)
+	fmt.Fprintf(w, "%s}\n", indent)
+	fmt.Fprintf(w, "%sif errs := internal.Validate(%s); errs != nil {\n", indent, ptr)
+	fmt.Fprintf(w, "%s\treturn respond.UnprocessableEntity(errs.Error(), errs...)\n", indent)
+	fmt.Fprintf(w, "%s}\n", indent)
 }
@@ -0,0 +1,57 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"testing"
+
+	"github.com/Jille/convreq"
+	"github.com/gorilla/mux"
+)
+
+type articleURLGet struct {
+	Category string `schema:"category"`
+	ID       int    `schema:"id"`
+	Sort     string `schema:"sort"`
+	Q        string `schema:"q,omitempty"`
+}
+
+func TestURL(t *testing.T) {
+	router := mux.NewRouter()
+	route := router.Path("/articles/{category}/{id:[0-9]+}").Queries("order", "{sort}")
+	tests := []struct {
+		get  articleURLGet
+		want string
+	}{
+		{
+			get:  articleURLGet{Category: "fish", ID: 42, Sort: "new"},
+			want: "/articles/fish/42?order=new",
+		},
+		{
+			get:  articleURLGet{Category: "fish", ID: 42, Sort: "new", Q: "chips"},
+			want: "/articles/fish/42?order=new&q=chips",
+		},
+	}
+	for _, tc := range tests {
+		u, err := convreq.URL(route, tc.get)
+		if err != nil {
+			t.Errorf("URL(%+v) failed: %v", tc.get, err)
+			continue
+		}
+		if got := u.String(); got != tc.want {
+			t.Errorf("URL(%+v) = %q; want %q", tc.get, got, tc.want)
+		}
+	}
+}
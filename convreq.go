@@ -18,6 +18,7 @@ package convreq
 import (
 	"context"
 
+	"github.com/Jille/convreq/genapi"
 	"github.com/Jille/convreq/internal"
 )
 
@@ -32,3 +33,116 @@ type ErrorHandler = internal.ErrorHandler
 func ContextWithErrorHandler(ctx context.Context, f ErrorHandler) context.Context {
 	return context.WithValue(ctx, internal.ErrorHandlerContextKey, f)
 }
+
+// PanicHandler is a callback type that you can register with ContextWithPanicHandler or WithPanicHandler to decide what to respond when a request handler panics.
+type PanicHandler = internal.PanicHandler
+
+// ContextWithPanicHandler returns a new context within which panics in request handlers are turned into a response by f.
+func ContextWithPanicHandler(ctx context.Context, f PanicHandler) context.Context {
+	return context.WithValue(ctx, internal.PanicHandlerContextKey, f)
+}
+
+// ResponseErrorHandler is a callback type that you can register with ContextWithResponseErrorHandler or WithResponseErrorHandler to be told about errors writing a response.
+// Without one, they're logged.
+type ResponseErrorHandler = internal.ResponseErrorHandler
+
+// ContextWithResponseErrorHandler returns a new context within which errors writing responses are passed to f.
+func ContextWithResponseErrorHandler(ctx context.Context, f ResponseErrorHandler) context.Context {
+	return context.WithValue(ctx, internal.ResponseErrorHandlerContextKey, f)
+}
+
+// DecodeError describes why (part of) the input couldn't be decoded, like a query parameter that isn't a number or a JSON syntax error.
+type DecodeError = internal.DecodeError
+
+// DecodeErrors is a list of problems with the input of a request. It's passed to the DecodeErrorHandler.
+type DecodeErrors = internal.DecodeErrors
+
+// DecodeErrorHandler is a callback type that you can register with ContextWithDecodeErrorHandler or WithDecodeErrorHandler to render input that couldn't be decoded.
+// Without a DecodeErrorHandler, DecodeErrors are rendered as a 400 Bad Request (through the ErrorHandler, if any).
+type DecodeErrorHandler = internal.DecodeErrorHandler
+
+// ContextWithDecodeErrorHandler returns a new context within which input that couldn't be decoded is rendered by f.
+func ContextWithDecodeErrorHandler(ctx context.Context, f DecodeErrorHandler) context.Context {
+	return context.WithValue(ctx, internal.DecodeErrorHandlerContextKey, f)
+}
+
+// FieldError describes why the value of a single input field was rejected.
+type FieldError = internal.FieldError
+
+// FieldErrors is a list of problems with input fields. It can be returned from the Validate() method of input structs to report problems with multiple fields.
+type FieldErrors = internal.FieldErrors
+
+// FieldErrorHandler is a callback type that you can register with ContextWithFieldErrorHandler or WithFieldErrorHandler to render errors about specific input fields, like failed validation.
+// Without a FieldErrorHandler, they're rendered by the ErrorHandler (without the fields) if there is one, or as JSON.
+type FieldErrorHandler = internal.FieldErrorHandler
+
+// ContextWithFieldErrorHandler returns a new context within which errors about input fields are rendered by f.
+func ContextWithFieldErrorHandler(ctx context.Context, f FieldErrorHandler) context.Context {
+	return context.WithValue(ctx, internal.FieldErrorHandlerContextKey, f)
+}
+
+// BodyDecoder decodes the request body into ret, which is a pointer. See WithBodyDecoder.
+type BodyDecoder = internal.BodyDecoder
+
+// UploadedFile is a file uploaded in a multipart form. Form input structs can have fields of type *UploadedFile or []*UploadedFile.
+// ContentType is sniffed from the contents, so unlike the Content-Type header of the part it can't be chosen freely by the client.
+type UploadedFile = internal.UploadedFile
+
+// MultipartStream can be taken as a parameter by request handlers to read the parts of a multipart form one by one, without buffering the files to memory or disk.
+// Form fields that precede the files can be decoded into a struct with DecodeFields. Errors from MultipartStream can be passed to DecodeFailed.
+type MultipartStream = internal.MultipartStream
+
+// Patch is a change to a value, like a MergePatch or a JSONPatch. Request handlers can take a Patch parameter to accept both, depending on the Content-Type.
+// Errors from Apply can be passed to DecodeFailed, which responds with 409 Conflict if a "test" operation failed and 422 Unprocessable Entity if the patch couldn't be applied.
+type Patch = internal.Patch
+
+// MergePatch is a JSON merge patch (RFC 7396). Request handlers can take a MergePatch parameter to accept an application/merge-patch+json body.
+type MergePatch = internal.MergePatch
+
+// JSONPatch is a JSON patch (RFC 6902). Request handlers can take a JSONPatch parameter to accept an application/json-patch+json body.
+type JSONPatch = internal.JSONPatch
+
+// PatchOperation is a single operation of a JSONPatch.
+type PatchOperation = internal.PatchOperation
+
+// PatchError is returned by Patch.Apply if the patch can't be applied, like when a path doesn't exist or the result doesn't fit in the target.
+type PatchError = internal.PatchError
+
+// PatchTestError is returned by JSONPatch.Apply if a "test" operation fails.
+type PatchTestError = internal.PatchTestError
+
+// Page is a page of a list, decoded from the query parameters limit and either offset or cursor. Request handlers can take a Page parameter and respond with respond.Paginated.
+// Invalid parameters get a 400 Bad Request, and limits above the maximum are lowered to it. See PageOptions.
+type Page = internal.Page
+
+// PageOptions configures the default and maximum limit of a Page, and the key its cursors are signed with. Pass it to WithPageOptions.
+type PageOptions = internal.PageOptions
+
+// ContextWithPageOptions returns a new context within which pages are decoded according to o.
+func ContextWithPageOptions(ctx context.Context, o PageOptions) context.Context {
+	return context.WithValue(ctx, internal.PageOptionsContextKey, o)
+}
+
+// LastEventID can be taken as a parameter by request handlers that stream Server-Sent Events (see respond.SSE) to resume after the last event a reconnecting client received.
+// It's empty on the first connection.
+type LastEventID = internal.LastEventID
+
+// DecodeFailed returns the response Wrap sends when decoding input fails with err, like a 400 Bad Request, 413 Payload Too Large or 422 Unprocessable Entity.
+func DecodeFailed(err error) HttpResponse {
+	return genapi.DecodeFailed(err)
+}
+
+// Decoder configures how path, query, header, cookie and form values are decoded into input structs: custom type converters, the struct tag to read field names from and more.
+// Create one with NewDecoder and pass it to WithDecoder.
+type Decoder = internal.Decoder
+
+// NewDecoder returns a Decoder with the default settings.
+// Besides the types gorilla/schema understands, it can decode time.Duration and types implementing encoding.TextUnmarshaler (like time.Time and net.IP).
+func NewDecoder() *Decoder {
+	return internal.NewDecoder()
+}
+
+// ContextWithDecoder returns a new context within which input is decoded by d.
+func ContextWithDecoder(ctx context.Context, d *Decoder) context.Context {
+	return context.WithValue(ctx, internal.DecoderContextKey, d)
+}
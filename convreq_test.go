@@ -28,6 +28,7 @@ import (
 
 	"github.com/Jille/convreq"
 	"github.com/Jille/convreq/respond"
+	"github.com/gorilla/mux"
 )
 
 type ArticlesCategoryHandlerGet struct {
@@ -68,6 +69,28 @@ func JasonPtrCategoryHandler(ctx context.Context, r *http.Request, input *JasonC
 	return respond.String(fmt.Sprintf("I like JSON. NewName=%s", input.NewName))
 }
 
+func jsonRequest(req *http.Request) *http.Request {
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func formRequest(req *http.Request) *http.Request {
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+type TaggedInput struct {
+	Category string                    `path:"category"`
+	Query    string                    `query:"q"`
+	Tenant   string                    `header:"X-Tenant,required"`
+	Session  string                    `cookie:"sid"`
+	Body     *JasonCategoryHandlerJSON `body:""`
+}
+
+func TaggedHandler(ctx context.Context, input *TaggedInput) convreq.HttpResponse {
+	return respond.Printf("category=%s q=%s tenant=%s sid=%s newname=%s", input.Category, input.Query, input.Tenant, input.Session, input.Body.NewName)
+}
+
 func TestStuff(t *testing.T) {
 	tests := []struct {
 		req         *http.Request
@@ -112,13 +135,30 @@ func TestStuff(t *testing.T) {
 			req:      httptest.NewRequest("POST", "/?category=test&id=not-a-number", strings.NewReader("newname=dude")),
 			handler:  ArticlesCategoryHandler,
 			wantCode: 400,
-			wantBody: "failed to parse url/query: schema: error converting value for \"id\"\n",
+			wantBody: "failed to parse query: id: cannot convert \"not-a-number\" to int64\n",
 		},
 		{
 			req:      httptest.NewRequest("POST", "/?category=test&id=7", strings.NewReader("newname=")),
 			handler:  ArticlesCategoryHandler,
 			wantCode: 400,
-			wantBody: "failed to parse form input: newname is empty\n",
+			wantBody: "failed to parse form: newname: is required\n",
+		},
+		{
+			req: func() *http.Request {
+				req := jsonRequest(httptest.NewRequest("POST", "/?q=search", strings.NewReader(`{"newname": "dude"}`)))
+				req.Header.Set("X-Tenant", "acme")
+				req.AddCookie(&http.Cookie{Name: "sid", Value: "s3cr3t"})
+				return mux.SetURLVars(req, map[string]string{"category": "test"})
+			}(),
+			handler:  TaggedHandler,
+			wantCode: 200,
+			wantBody: "category=test q=search tenant=acme sid=s3cr3t newname=dude",
+		},
+		{
+			req:      jsonRequest(httptest.NewRequest("POST", "/?q=search", strings.NewReader(`{"newname": "dude"}`))),
+			handler:  TaggedHandler,
+			wantCode: 400,
+			wantBody: "failed to parse header: X-Tenant: is required\n",
 		},
 		{
 			// Test return value error.
@@ -129,6 +169,50 @@ func TestStuff(t *testing.T) {
 			wantCode: 500,
 			wantBody: "test\n",
 		},
+		{
+			// Test return values (T, error).
+			req: httptest.NewRequest("GET", "/", nil),
+			handler: func() (*JasonCategoryHandlerJSON, error) {
+				return &JasonCategoryHandlerJSON{Category: "test", NewName: "dude"}, nil
+			},
+			wantCode:    200,
+			wantHeaders: map[string]string{"Content-Type": "application/json"},
+			wantBody:    "{\"category\":\"test\",\"newname\":\"dude\"}\n",
+		},
+		{
+			req: httptest.NewRequest("GET", "/", nil),
+			handler: func() (*JasonCategoryHandlerJSON, error) {
+				return nil, errors.New("test")
+			},
+			wantCode: 500,
+			wantBody: "test\n",
+		},
+		{
+			req: httptest.NewRequest("GET", "/", nil),
+			handler: func() (convreq.HttpResponse, error) {
+				return respond.String("hi"), nil
+			},
+			wantCode: 200,
+			wantBody: "hi",
+		},
+		{
+			req: httptest.NewRequest("GET", "/", nil),
+			handler: func() (convreq.HttpResponse, error) {
+				return respond.String("hi"), errors.New("test")
+			},
+			wantCode: 500,
+			wantBody: "test\n",
+		},
+		{
+			// Test nil HttpResponse.
+			req: httptest.NewRequest("GET", "/", nil),
+			handler: func(w http.ResponseWriter) convreq.HttpResponse {
+				w.WriteHeader(202)
+				return nil
+			},
+			wantCode: 202,
+			wantBody: "",
+		},
 		{
 			req: httptest.NewRequest("GET", "/", nil),
 			// Test no return value.
@@ -218,46 +302,46 @@ func TestStuff(t *testing.T) {
 			wantBody: "7 is a number",
 		},
 		{
-			req:      httptest.NewRequest("POST", "/", strings.NewReader(`{"category": "unimplemented", "id": 1}`)),
+			req:      jsonRequest(httptest.NewRequest("POST", "/", strings.NewReader(`{"category": "unimplemented", "id": 1}`))),
 			handler:  JasonCategoryHandler,
 			wantCode: 500,
 			wantBody: "not yet implemented\n",
 		},
 		{
-			req:      httptest.NewRequest("POST", "/", strings.NewReader(`{"category": "unimplemented", "id": 1}`)),
+			req:      jsonRequest(httptest.NewRequest("POST", "/", strings.NewReader(`{"category": "unimplemented", "id": 1}`))),
 			handler:  JasonPtrCategoryHandler,
 			wantCode: 500,
 			wantBody: "not yet implemented\n",
 		},
 		{
-			req:      httptest.NewRequest("POST", "/", strings.NewReader(`{"category": "test", "newname": "dude"}`)),
+			req:      jsonRequest(httptest.NewRequest("POST", "/", strings.NewReader(`{"category": "test", "newname": "dude"}`))),
 			handler:  JasonCategoryHandler,
 			wantCode: 200,
 			wantBody: "I like JSON. NewName=dude",
 		},
 		{
-			req:      httptest.NewRequest("POST", "/", strings.NewReader(`{"category": "test", "newname": "dude"}`)),
+			req:      jsonRequest(httptest.NewRequest("POST", "/", strings.NewReader(`{"category": "test", "newname": "dude"}`))),
 			handler:  JasonPtrCategoryHandler,
 			wantCode: 200,
 			wantBody: "I like JSON. NewName=dude",
 		},
 		{
-			req:      httptest.NewRequest("POST", "/", nil),
+			req:      jsonRequest(httptest.NewRequest("POST", "/", nil)),
 			handler:  JasonCategoryHandler,
 			wantCode: 400,
-			wantBody: "failed to decode json body: EOF\n",
+			wantBody: "failed to parse json: body is empty\n",
 		},
 		{
-			req:      httptest.NewRequest("POST", "/", strings.NewReader(`bad json`)),
+			req:      jsonRequest(httptest.NewRequest("POST", "/", strings.NewReader(`bad json`))),
 			handler:  JasonPtrCategoryHandler,
 			wantCode: 400,
-			wantBody: "failed to decode json body: invalid character 'b' looking for beginning of value\n",
+			wantBody: "failed to parse json: invalid character 'b' looking for beginning of value\n",
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.req.URL.String(), func(t *testing.T) {
-			if tc.req.Method == "POST" {
+			if tc.req.Method == "POST" && tc.req.Header.Get("Content-Type") == "" {
 				tc.req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 			}
 			respRecorder := httptest.NewRecorder()
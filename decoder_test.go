@@ -0,0 +1,267 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+type color int
+
+const (
+	red color = iota + 1
+	green
+)
+
+type stdlibGet struct {
+	Since time.Time     `schema:"since"`
+	Delay time.Duration `schema:"delay"`
+	IP    net.IP        `schema:"ip"`
+}
+
+type listGet struct {
+	IDs    []int   `json:"ids"`
+	Colors []color `json:"colors"`
+}
+
+func TestDecoder(t *testing.T) {
+	dec := convreq.NewDecoder()
+	dec.SetAliasTag("json")
+	dec.CommaSeparated(true)
+	dec.MaxSliceLength(3)
+	dec.RegisterConverter(color(0), func(s string) reflect.Value {
+		switch s {
+		case "red":
+			return reflect.ValueOf(red)
+		case "green":
+			return reflect.ValueOf(green)
+		}
+		return reflect.Value{}
+	})
+	stdlib := convreq.Wrap(func(get stdlibGet) convreq.HttpResponse {
+		return respond.Printf("%s %s %s", get.Since.Format(time.RFC3339), get.Delay, get.IP)
+	})
+	lists := convreq.Wrap(func(get listGet) convreq.HttpResponse {
+		return respond.String(fmt.Sprint(get.IDs, get.Colors))
+	}, convreq.WithDecoder(dec))
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "stdlib types",
+			handler:  stdlib,
+			query:    "?since=2020-01-02T03:04:05Z&delay=1m30s&ip=192.0.2.1",
+			wantCode: 200,
+			wantBody: "2020-01-02T03:04:05Z 1m30s 192.0.2.1",
+		},
+		{
+			name:     "bad duration",
+			handler:  stdlib,
+			query:    "?delay=soon",
+			wantCode: 400,
+			wantBody: "failed to parse query: delay: cannot convert \"soon\" to time.Duration\n",
+		},
+		{
+			name:     "comma separated",
+			handler:  lists,
+			query:    "?ids=1,2&ids=3&colors=red,green",
+			wantCode: 200,
+			wantBody: "[1 2 3] [1 2]",
+		},
+		{
+			name:     "too many values",
+			handler:  lists,
+			query:    "?ids=1,2,3,4",
+			wantCode: 400,
+			wantBody: "failed to parse query: ids: has more than 3 values\n",
+		},
+		{
+			name:     "unknown enum value",
+			handler:  lists,
+			query:    "?colors=blue",
+			wantCode: 400,
+			wantBody: "failed to parse query: colors: cannot convert \"blue\" to convreq_test.color\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			tc.handler.ServeHTTP(respRecorder, httptest.NewRequest("GET", "/"+tc.query, nil))
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
+
+type authHeaders struct {
+	Authorization string `schema:"Authorization,required,unauthorized"`
+	RequestID     int    `schema:"x-request-id"`
+}
+
+type prefsCookies struct {
+	Theme string `schema:"theme,required"`
+}
+
+func TestHeadersAndCookies(t *testing.T) {
+	handler := convreq.Wrap(func(h authHeaders, c prefsCookies) convreq.HttpResponse {
+		return respond.Printf("%s %d %s", h.Authorization, h.RequestID, c.Theme)
+	})
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "ok",
+			headers:  map[string]string{"Authorization": "Bearer x", "X-Request-Id": "7", "Cookie": "theme=dark"},
+			wantCode: 200,
+			wantBody: "Bearer x 7 dark",
+		},
+		{
+			name:     "no authorization",
+			headers:  map[string]string{"Cookie": "theme=dark"},
+			wantCode: 401,
+			wantBody: "failed to parse header: Authorization: is required\n",
+		},
+		{
+			name:     "bad header",
+			headers:  map[string]string{"Authorization": "Bearer x", "X-Request-Id": "seven", "Cookie": "theme=dark"},
+			wantCode: 400,
+			wantBody: "failed to parse header: X-Request-Id: cannot convert \"seven\" to int\n",
+		},
+		{
+			name:     "no cookie",
+			headers:  map[string]string{"Authorization": "Bearer x"},
+			wantCode: 400,
+			wantBody: "failed to parse cookie: theme: is required\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
+
+type searchGet struct {
+	Q      string        `schema:"q"`
+	Limit  int           `schema:"limit" default:"50"`
+	Sort   []string      `schema:"sort" default:"name,id"`
+	Window time.Duration `schema:"window"`
+}
+
+func (g *searchGet) Defaults() {
+	g.Window = time.Hour
+}
+
+type searchPost struct {
+	Limit int `schema:"limit" default:"10"`
+}
+
+type searchTagged struct {
+	Limit int    `query:"limit" default:"25"`
+	Lang  string `header:"Accept-Language" default:"en"`
+}
+
+func TestDefaults(t *testing.T) {
+	get := convreq.Wrap(func(get searchGet) convreq.HttpResponse {
+		return respond.Printf("%q %d %v %s", get.Q, get.Limit, get.Sort, get.Window)
+	})
+	post := convreq.Wrap(func(post *searchPost) convreq.HttpResponse {
+		return respond.Printf("%d", post.Limit)
+	})
+	tagged := convreq.Wrap(func(in searchTagged) convreq.HttpResponse {
+		return respond.Printf("%d %s", in.Limit, in.Lang)
+	})
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		req      *http.Request
+		wantBody string
+	}{
+		{
+			name:     "get defaults",
+			handler:  get,
+			req:      httptest.NewRequest("GET", "/?q=dude", nil),
+			wantBody: `"dude" 50 [name id] 1h0m0s`,
+		},
+		{
+			name:     "get values",
+			handler:  get,
+			req:      httptest.NewRequest("GET", "/?LIMIT=5&sort=date&window=1m", nil),
+			wantBody: `"" 5 [date] 1m0s`,
+		},
+		{
+			name:     "post default",
+			handler:  post,
+			req:      formRequest(httptest.NewRequest("POST", "/", nil)),
+			wantBody: "10",
+		},
+		{
+			name:     "post value",
+			handler:  post,
+			req:      formRequest(httptest.NewRequest("POST", "/", strings.NewReader("limit=3"))),
+			wantBody: "3",
+		},
+		{
+			name:     "tagged",
+			handler:  tagged,
+			req:      httptest.NewRequest("GET", "/", nil),
+			wantBody: "25 en",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			tc.handler.ServeHTTP(respRecorder, tc.req)
+			if respRecorder.Code != 200 {
+				t.Errorf("got code %d; want 200", respRecorder.Code)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+type UploadPost struct {
+	Title       string                  `schema:"title"`
+	Avatar      *convreq.UploadedFile   `schema:"avatar" file:"maxsize=64,types=image/png image/gif"`
+	Attachments []*multipart.FileHeader `schema:"attachments"`
+}
+
+func UploadHandler(post *UploadPost) convreq.HttpResponse {
+	ret := post.Title
+	if post.Avatar != nil {
+		ret += " avatar=" + post.Avatar.Filename + " " + post.Avatar.ContentType
+	}
+	for _, a := range post.Attachments {
+		ret += " attachment=" + a.Filename
+	}
+	return respond.String(ret)
+}
+
+// gif is the smallest valid GIF.
+var gif = []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+
+type formFile struct {
+	field, name string
+	data        []byte
+}
+
+func multipartRequest(fields map[string]string, files ...formFile) *http.Request {
+	var buf bytes.Buffer
+	mp := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		mp.WriteField(k, v)
+	}
+	for _, f := range files {
+		w, _ := mp.CreateFormFile(f.field, f.name)
+		w.Write(f.data)
+	}
+	mp.Close()
+	req := httptest.NewRequest("POST", "/", &buf)
+	req.Header.Set("Content-Type", mp.FormDataContentType())
+	return req
+}
+
+func TestFileUploads(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *http.Request
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "files",
+			req:      multipartRequest(map[string]string{"title": "hi"}, formFile{"avatar", "me.gif", gif}, formFile{"attachments", "a.txt", []byte("a")}, formFile{"attachments", "b.txt", []byte("b")}),
+			wantCode: 200,
+			wantBody: "hi avatar=me.gif image/gif attachment=a.txt attachment=b.txt",
+		},
+		{
+			name:     "no files",
+			req:      multipartRequest(map[string]string{"title": "hi", "avatar.Filename": "forged"}),
+			wantCode: 200,
+			wantBody: "hi",
+		},
+		{
+			name:     "too large",
+			req:      multipartRequest(nil, formFile{"avatar", "me.gif", append(gif, make([]byte, 64)...)}),
+			wantCode: 413,
+			wantBody: "file avatar is 78 bytes; the limit is 64 bytes\n",
+		},
+		{
+			name:     "wrong type",
+			req:      multipartRequest(nil, formFile{"avatar", "me.gif", []byte("<html></html>")}),
+			wantCode: 415,
+			wantBody: "file avatar is of type \"text/html\"; expected image/png, image/gif\n",
+		},
+	}
+	handler := convreq.Wrap(UploadHandler)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, tc.req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
+
+type BadUploadPost struct {
+	Avatar *convreq.UploadedFile `file:"maxsize=big"`
+}
+
+func TestFileUploadsBadTag(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Wrap didn't panic on an invalid file tag")
+		}
+	}()
+	convreq.Wrap(func(post *BadUploadPost) {})
+}
+
+type StreamFields struct {
+	Title string `schema:"title" validate:"required"`
+}
+
+func TestMultipartStream(t *testing.T) {
+	handler := convreq.Wrap(func(s *convreq.MultipartStream) convreq.HttpResponse {
+		var fields StreamFields
+		if err := s.DecodeFields(&fields); err != nil {
+			return convreq.DecodeFailed(err)
+		}
+		ret := fields.Title
+		for {
+			p, err := s.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return convreq.DecodeFailed(err)
+			}
+			b, err := io.ReadAll(p)
+			if err != nil {
+				return respond.Error(err)
+			}
+			ret += " " + p.FileName() + "=" + string(b)
+		}
+		return respond.String(ret)
+	}, convreq.WithMaxMultipartParts(3), convreq.WithErrorHandler(func(code int, msg string, r *http.Request) convreq.HttpResponse {
+		return respond.Printf("%d: %s", code, msg)
+	}))
+	tests := []struct {
+		name     string
+		req      *http.Request
+		wantBody string
+	}{
+		{
+			name:     "fields and files",
+			req:      multipartRequest(map[string]string{"title": "hi"}, formFile{"a", "a.txt", []byte("aaa")}, formFile{"b", "b.txt", []byte("bbb")}),
+			wantBody: "hi a.txt=aaa b.txt=bbb",
+		},
+		{
+			name:     "invalid fields",
+			req:      multipartRequest(nil, formFile{"a", "a.txt", []byte("aaa")}),
+			wantBody: "422: title: is required",
+		},
+		{
+			name:     "too many parts",
+			req:      multipartRequest(map[string]string{"title": "hi"}, formFile{"a", "a.txt", nil}, formFile{"b", "b.txt", nil}, formFile{"c", "c.txt", nil}),
+			wantBody: "413: multipart form has more than 3 parts",
+		},
+		{
+			name:     "not multipart",
+			req:      formRequest(httptest.NewRequest("POST", "/", strings.NewReader("title=hi"))),
+			wantBody: "415: expected Content-Type: multipart/form-data rather than \"application/x-www-form-urlencoded\"",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, tc.req)
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
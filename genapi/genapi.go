@@ -16,19 +16,117 @@
 package genapi
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"runtime/debug"
+	"strings"
 
 	"github.com/Jille/convreq/internal"
 	"github.com/Jille/convreq/respond"
 )
 
+// PanicHandler returns a function to be deferred that turns a panic into a response in hr.
+//
+// Deprecated: Use RecoverPanic() instead, which also honors the PanicHandler in the request context.
 func PanicHandler(hr *internal.HttpResponse) func() {
 	return func() {
-		if r := recover(); r != nil {
-			log.Printf("panic: %v\n%s", r, debug.Stack())
-			*hr = respond.Error(fmt.Errorf("panic: %v", r))
+		if p := recover(); p != nil {
+			*hr = defaultPanicHandler(nil, p)
+		}
+	}
+}
+
+// RecoverPanic returns a function to be deferred that turns a panic into a response in hr.
+func RecoverPanic(r *http.Request, hr *internal.HttpResponse) func() {
+	return func() {
+		if p := recover(); p != nil {
+			*hr = HandlePanic(r, p)
 		}
 	}
 }
+
+// HandlePanic returns the response for a recovered panic p.
+// It calls the PanicHandler from the request context, or logs the panic and returns respond.Error() if there is none.
+// http.ErrAbortHandler is propagated rather than handled.
+func HandlePanic(r *http.Request, p interface{}) internal.HttpResponse {
+	if p == http.ErrAbortHandler {
+		panic(p)
+	}
+	if f, ok := r.Context().Value(internal.PanicHandlerContextKey).(internal.PanicHandler); ok {
+		return f(r, p)
+	}
+	return defaultPanicHandler(r, p)
+}
+
+func defaultPanicHandler(r *http.Request, p interface{}) internal.HttpResponse {
+	log.Printf("panic: %v\n%s", p, debug.Stack())
+	return respond.Error(fmt.Errorf("panic: %v", p))
+}
+
+// DecodeFailed returns the response for an error from one of the internal.Decode* functions.
+func DecodeFailed(err error) internal.HttpResponse {
+	var umt *internal.UnsupportedMediaTypeError
+	if errors.As(err, &umt) {
+		return respond.UnsupportedMediaType(err.Error())
+	}
+	var uee *internal.UnsupportedEncodingError
+	if errors.As(err, &uee) {
+		return respond.WithHeader(respond.UnsupportedMediaType(err.Error()), "Accept-Encoding", strings.Join(internal.SupportedEncodings, ", "))
+	}
+	var fte *internal.FileTooLargeError
+	if errors.As(err, &fte) {
+		return respond.PayloadTooLarge(err.Error())
+	}
+	var fty *internal.FileTypeError
+	if errors.As(err, &fty) {
+		return respond.UnsupportedMediaType(err.Error())
+	}
+	var mle *internal.MultipartLimitError
+	if errors.As(err, &mle) {
+		return respond.PayloadTooLarge(err.Error())
+	}
+	var rtle *internal.RecordTooLargeError
+	if errors.As(err, &rtle) {
+		return respond.PayloadTooLarge(err.Error())
+	}
+	var pte *internal.PatchTestError
+	if errors.As(err, &pte) {
+		return respond.Conflict(err.Error())
+	}
+	var pe *internal.PatchError
+	if errors.As(err, &pe) {
+		return respond.UnprocessableEntity(err.Error())
+	}
+	var fe internal.FieldErrors
+	if errors.As(err, &fe) {
+		return respond.UnprocessableEntity(fe.Error(), fe...)
+	}
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return respond.PayloadTooLarge(fmt.Sprintf("request body too large; the limit is %d bytes", mbe.Limit))
+	}
+	var ue *internal.UnauthorizedError
+	if errors.As(err, &ue) {
+		return respond.Unauthorized(err.Error())
+	}
+	var des internal.DecodeErrors
+	if errors.As(err, &des) {
+		return decodeErrorResponse{des}
+	}
+	return respond.BadRequest(err.Error())
+}
+
+// decodeErrorResponse renders DecodeErrors with the DecodeErrorHandler from the request context, or as a 400 Bad Request.
+type decodeErrorResponse struct {
+	errs internal.DecodeErrors
+}
+
+// Respond implements convreq.HttpResponse.
+func (d decodeErrorResponse) Respond(w http.ResponseWriter, r *http.Request) error {
+	if h, ok := r.Context().Value(internal.DecodeErrorHandlerContextKey).(internal.DecodeErrorHandler); ok {
+		return h(r, d.errs).Respond(w, r)
+	}
+	return respond.BadRequest(d.errs.Error()).Respond(w, r)
+}
@@ -1,6 +1,6 @@
 module github.com/Jille/convreq
 
-go 1.17
+go 1.19
 
 require (
 	github.com/gorilla/mux v1.8.0
@@ -0,0 +1,231 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+
+	"github.com/Jille/convreq/internal"
+)
+
+// The Handle* functions are type safe alternatives to Wrap for the most common signatures.
+// They decode and validate their input the same way Wrap does, but don't need reflection at request time.
+// G is decoded like a Get struct, P like a Post struct (nil unless the request is a POST) and J like a JSON struct.
+// If P's name ends in Put, Patch, Delete or Form, it's decoded for those methods instead, like Wrap does, and a P for Put, Patch or Delete makes other methods than that one, GET, HEAD and OPTIONS get a 405.
+// The *Result variants handle (T, error) return values like Wrap does.
+// Options that only affect the handler signature (like WithParameterType) have no effect.
+
+// Handle returns a http.HandlerFunc for a handler taking GET and POST input.
+func Handle[G, P any](f func(context.Context, *http.Request, G, *P) HttpResponse, opts ...WrapOption) http.HandlerFunc {
+	return handle(newWrapOptions(opts), f)
+}
+
+func handle[G, P any](wo *wrapOptions, f func(context.Context, *http.Request, G, *P) HttpResponse) http.HandlerFunc {
+	checkValidation(typeOf[G]())
+	checkValidation(typeOf[P]())
+	method, methods := postMethod[P]()
+	return adapt(wo, func(w http.ResponseWriter, r *http.Request) HttpResponse {
+		if hr := methods.notAllowed(r); hr != nil {
+			return hr
+		}
+		var get G
+		if hr := decodeGet(r, &get); hr != nil {
+			return hr
+		}
+		var post *P
+		if decodesForm(method, r.Method) {
+			post = new(P)
+			if hr := decodeForm(r, post); hr != nil {
+				return hr
+			}
+		}
+		return f(r.Context(), r, get, post)
+	})
+}
+
+// HandleGet returns a http.HandlerFunc for a handler taking GET input.
+func HandleGet[G any](f func(context.Context, *http.Request, G) HttpResponse, opts ...WrapOption) http.HandlerFunc {
+	return handleGet(newWrapOptions(opts), f)
+}
+
+func handleGet[G any](wo *wrapOptions, f func(context.Context, *http.Request, G) HttpResponse) http.HandlerFunc {
+	checkValidation(typeOf[G]())
+	return adapt(wo, func(w http.ResponseWriter, r *http.Request) HttpResponse {
+		var get G
+		if hr := decodeGet(r, &get); hr != nil {
+			return hr
+		}
+		return f(r.Context(), r, get)
+	})
+}
+
+// HandlePost returns a http.HandlerFunc for a handler taking POST input.
+func HandlePost[P any](f func(context.Context, *http.Request, *P) HttpResponse, opts ...WrapOption) http.HandlerFunc {
+	return handlePost(newWrapOptions(opts), f)
+}
+
+func handlePost[P any](wo *wrapOptions, f func(context.Context, *http.Request, *P) HttpResponse) http.HandlerFunc {
+	checkValidation(typeOf[P]())
+	method, methods := postMethod[P]()
+	return adapt(wo, func(w http.ResponseWriter, r *http.Request) HttpResponse {
+		if hr := methods.notAllowed(r); hr != nil {
+			return hr
+		}
+		var post *P
+		if decodesForm(method, r.Method) {
+			post = new(P)
+			if hr := decodeForm(r, post); hr != nil {
+				return hr
+			}
+		}
+		return f(r.Context(), r, post)
+	})
+}
+
+// HandleJSON returns a http.HandlerFunc for a handler taking a JSON request body. J may be a pointer.
+func HandleJSON[J any](f func(context.Context, *http.Request, J) HttpResponse, opts ...WrapOption) http.HandlerFunc {
+	return handleJSON(newWrapOptions(opts), f)
+}
+
+func handleJSON[J any](wo *wrapOptions, f func(context.Context, *http.Request, J) HttpResponse) http.HandlerFunc {
+	t := typeOf[J]()
+	checkValidation(t)
+	return adapt(wo, func(w http.ResponseWriter, r *http.Request) HttpResponse {
+		var input J
+		var target interface{} = &input
+		if t.Kind() == reflect.Ptr {
+			// Decode into a new value like Wrap does, so a null body doesn't leave the handler with a nil pointer.
+			reflect.ValueOf(&input).Elem().Set(reflect.New(t.Elem()))
+			target = input
+		}
+		if hr := decodeJSON(r, target); hr != nil {
+			return hr
+		}
+		return f(r.Context(), r, input)
+	})
+}
+
+// HandleResult is like Handle for handlers returning (T, error).
+func HandleResult[G, P, T any](f func(context.Context, *http.Request, G, *P) (T, error), opts ...WrapOption) http.HandlerFunc {
+	wo := newWrapOptions(opts)
+	rr := newResultRenderer[T](wo)
+	return handle(wo, func(ctx context.Context, r *http.Request, get G, post *P) HttpResponse {
+		v, err := f(ctx, r, get, post)
+		return rr.response(v, err)
+	})
+}
+
+// HandleGetResult is like HandleGet for handlers returning (T, error).
+func HandleGetResult[G, T any](f func(context.Context, *http.Request, G) (T, error), opts ...WrapOption) http.HandlerFunc {
+	wo := newWrapOptions(opts)
+	rr := newResultRenderer[T](wo)
+	return handleGet(wo, func(ctx context.Context, r *http.Request, get G) HttpResponse {
+		v, err := f(ctx, r, get)
+		return rr.response(v, err)
+	})
+}
+
+// HandlePostResult is like HandlePost for handlers returning (T, error).
+func HandlePostResult[P, T any](f func(context.Context, *http.Request, *P) (T, error), opts ...WrapOption) http.HandlerFunc {
+	wo := newWrapOptions(opts)
+	rr := newResultRenderer[T](wo)
+	return handlePost(wo, func(ctx context.Context, r *http.Request, post *P) HttpResponse {
+		v, err := f(ctx, r, post)
+		return rr.response(v, err)
+	})
+}
+
+// HandleJSONResult is like HandleJSON for handlers returning (T, error).
+func HandleJSONResult[J, T any](f func(context.Context, *http.Request, J) (T, error), opts ...WrapOption) http.HandlerFunc {
+	wo := newWrapOptions(opts)
+	rr := newResultRenderer[T](wo)
+	return handleJSON(wo, func(ctx context.Context, r *http.Request, input J) HttpResponse {
+		v, err := f(ctx, r, input)
+		return rr.response(v, err)
+	})
+}
+
+// adapt returns a http.HandlerFunc that calls f through wo.serve and sends the response.
+func adapt(wo *wrapOptions, f func(w http.ResponseWriter, r *http.Request) HttpResponse) http.HandlerFunc {
+	call := func(w http.ResponseWriter, r *http.Request) {
+		internal.DoRespond(w, r, f(w, r))
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		wo.serve(w, r, call)
+	}
+}
+
+// postMethod returns the method for which P is decoded (see formInputMethod) and the methodSet for a handler taking it.
+// P's with other names than the form input suffixes are decoded for POST.
+func postMethod[P any]() (string, methodSet) {
+	method, ok := formInputMethod(reflect.PtrTo(typeOf[P]()))
+	if !ok {
+		method = "POST"
+	}
+	if method == "" {
+		return method, nil
+	}
+	return method, methodSet{method: true}
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// resultRenderer renders (T, error) return values like Wrap does.
+type resultRenderer[T any] struct {
+	render func(w http.ResponseWriter, r *http.Request, v T)
+}
+
+func newResultRenderer[T any](wo *wrapOptions) resultRenderer[T] {
+	t := typeOf[T]()
+	if h, ok := wo.handlers[t]; ok && t != httpResponseType {
+		return resultRenderer[T]{func(w http.ResponseWriter, r *http.Request, v T) {
+			h.Call([]reflect.Value{reflect.ValueOf(w), reflect.ValueOf(r), reflect.ValueOf(&v).Elem()})
+		}}
+	}
+	if t.Implements(httpResponseType) {
+		return resultRenderer[T]{func(w http.ResponseWriter, r *http.Request, v T) {
+			hr, _ := interface{}(v).(HttpResponse)
+			internal.DoRespond(w, r, hr)
+		}}
+	}
+	renderer := wo.renderer
+	return resultRenderer[T]{func(w http.ResponseWriter, r *http.Request, v T) {
+		internal.DoRespond(w, r, renderer(v))
+	}}
+}
+
+func (rr resultRenderer[T]) response(v T, err error) HttpResponse {
+	return resultResponse[T]{rr, v, err}
+}
+
+type resultResponse[T any] struct {
+	rr  resultRenderer[T]
+	v   T
+	err error
+}
+
+// Respond implements convreq.HttpResponse.
+func (res resultResponse[T]) Respond(w http.ResponseWriter, r *http.Request) error {
+	if res.err != nil {
+		handleError(w, r, res.err)
+		return nil
+	}
+	res.rr.render(w, r, res.v)
+	return nil
+}
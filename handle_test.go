@@ -0,0 +1,127 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *http.Request
+		handler  http.Handler
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "Handle GET",
+			req:  httptest.NewRequest("GET", "/?category=test&id=7", nil),
+			handler: convreq.Handle(func(ctx context.Context, r *http.Request, get ArticlesCategoryHandlerGet, post *ArticlesCategoryHandlerPost) convreq.HttpResponse {
+				return ArticlesCategoryHandler(ctx, r, get, post)
+			}),
+			wantCode: 200,
+			wantBody: "Hello world. Id=7",
+		},
+		{
+			name:     "Handle POST",
+			req:      formRequest(httptest.NewRequest("POST", "/?category=test&id=7", strings.NewReader("newname=dude"))),
+			handler:  convreq.Handle(ArticlesCategoryHandler),
+			wantCode: 200,
+			wantBody: "I like post. NewName=dude",
+		},
+		{
+			name:     "Handle bad POST",
+			req:      formRequest(httptest.NewRequest("POST", "/?category=test&id=7", strings.NewReader("newname="))),
+			handler:  convreq.Handle(ArticlesCategoryHandler),
+			wantCode: 400,
+			wantBody: "failed to parse form: newname: is required\n",
+		},
+		{
+			name: "HandleGet validation",
+			req:  httptest.NewRequest("GET", "/?name=q", nil),
+			handler: convreq.HandleGet(func(ctx context.Context, r *http.Request, get SignupGet) convreq.HttpResponse {
+				return respond.String("ok")
+			}),
+			wantCode: 422,
+			wantBody: `{"error":"name: must have length at least 2","fields":[{"field":"name","reason":"must have length at least 2"}]}` + "\n",
+		},
+		{
+			name:     "HandleJSON",
+			req:      jsonRequest(httptest.NewRequest("POST", "/", strings.NewReader(`{"category": "test", "newname": "dude"}`))),
+			handler:  convreq.HandleJSON(JasonPtrCategoryHandler),
+			wantCode: 200,
+			wantBody: "I like JSON. NewName=dude",
+		},
+		{
+			name:     "HandleJSON null",
+			req:      jsonRequest(httptest.NewRequest("POST", "/", strings.NewReader(`null`))),
+			handler:  convreq.HandleJSON(JasonPtrCategoryHandler),
+			wantCode: 200,
+			wantBody: "I like JSON. NewName=",
+		},
+		{
+			name: "HandleJSONResult",
+			req:  jsonRequest(httptest.NewRequest("POST", "/", strings.NewReader(`{"category": "test", "newname": "dude"}`))),
+			handler: convreq.HandleJSONResult(func(ctx context.Context, r *http.Request, input JasonCategoryHandlerJSON) (*JasonCategoryHandlerJSON, error) {
+				input.Category = "changed"
+				return &input, nil
+			}),
+			wantCode: 200,
+			wantBody: "{\"category\":\"changed\",\"newname\":\"dude\"}\n",
+		},
+		{
+			name: "HandleGetResult error",
+			req:  httptest.NewRequest("GET", "/", nil),
+			handler: convreq.HandleGetResult(func(ctx context.Context, r *http.Request, get ArticlesCategoryHandlerGet) (convreq.HttpResponse, error) {
+				return nil, errors.New("test")
+			}),
+			wantCode: 500,
+			wantBody: "test\n",
+		},
+		{
+			name: "HandlePostResult with options",
+			req:  formRequest(httptest.NewRequest("POST", "/", strings.NewReader("newname=dude"))),
+			handler: convreq.HandlePostResult(func(ctx context.Context, r *http.Request, post *ArticlesCategoryHandlerPost) (string, error) {
+				return post.NewName, nil
+			}, convreq.WithDefaultRenderer(func(data interface{}) convreq.HttpResponse {
+				return respond.String(fmt.Sprint(data))
+			})),
+			wantCode: 200,
+			wantBody: "dude",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			tc.handler.ServeHTTP(respRecorder, tc.req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
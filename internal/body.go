@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// BodyDecoder decodes the request body into ret, which is a pointer.
+type BodyDecoder func(r *http.Request, ret interface{}) error
+
+// DefaultBodyDecoders are the BodyDecoders for ...Body inputs, by media type.
+var DefaultBodyDecoders = map[string]BodyDecoder{
+	"application/json":                  decodeJSONBody,
+	"text/json":                         decodeJSONBody,
+	"application/xml":                   decodeXMLBody,
+	"text/xml":                          decodeXMLBody,
+	"application/x-www-form-urlencoded": DecodeForm,
+	"multipart/form-data":               DecodeForm,
+}
+
+// UnsupportedMediaTypeError is returned if there's no BodyDecoder for the Content-Type of the request.
+type UnsupportedMediaTypeError struct {
+	// MediaType is the media type of the request, or empty if the Content-Type was unset.
+	MediaType string
+	// Accepted are the media types that could have been decoded.
+	Accepted []string
+}
+
+func (e *UnsupportedMediaTypeError) Error() string {
+	if e.MediaType == "" {
+		return fmt.Sprintf("expected Content-Type: %s rather than unset", strings.Join(e.Accepted, ", "))
+	}
+	return fmt.Sprintf("expected Content-Type: %s rather than %q", strings.Join(e.Accepted, ", "), e.MediaType)
+}
+
+// DecodeBody decodes the request body into ret with the BodyDecoder for its media type.
+// Media types with a structured syntax suffix (like application/problem+json) fall back to the decoder for application/json or application/xml.
+// If decoders is nil, DefaultBodyDecoders is used.
+func DecodeBody(r *http.Request, ret interface{}, decoders map[string]BodyDecoder) error {
+	if decoders == nil {
+		decoders = DefaultBodyDecoders
+	}
+	mt := mediaType(r)
+	d, ok := decoders[mt]
+	if !ok {
+		if i := strings.LastIndexByte(mt, '+'); i != -1 {
+			d, ok = decoders["application/"+mt[i+1:]]
+		}
+	}
+	if !ok {
+		accepted := make([]string, 0, len(decoders))
+		for t := range decoders {
+			accepted = append(accepted, t)
+		}
+		sort.Strings(accepted)
+		return &UnsupportedMediaTypeError{MediaType: mt, Accepted: accepted}
+	}
+	if err := limitBody(r, ret); err != nil {
+		return err
+	}
+	return d(r, ret)
+}
+
+// mediaType returns the lowercased media type of the request body without parameters, or empty if it's unset.
+func mediaType(r *http.Request) string {
+	ct := r.Header.Get("Content-Type")
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(ct))
+	}
+	return mt
+}
+
+// isJSON returns whether mt is a JSON media type.
+func isJSON(mt string) bool {
+	return mt == "application/json" || mt == "text/json" || (strings.HasPrefix(mt, "application/") && strings.HasSuffix(mt, "+json"))
+}
+
+func decodeJSONBody(r *http.Request, ret interface{}) error {
+	return readJSON(r, ret, isStrict(r, ret))
+}
+
+// readJSON decodes the request body into ret as JSON. If strict is set, unknown fields are rejected.
+func readJSON(r *http.Request, ret interface{}, strict bool) error {
+	defer r.Body.Close()
+	d := json.NewDecoder(r.Body)
+	if strict {
+		d.DisallowUnknownFields()
+	}
+	if err := d.Decode(ret); err != nil {
+		return bodyError("json", err)
+	}
+	return nil
+}
+
+func decodeXMLBody(r *http.Request, ret interface{}) error {
+	defer r.Body.Close()
+	if err := xml.NewDecoder(r.Body).Decode(ret); err != nil {
+		return bodyError("xml", err)
+	}
+	return nil
+}
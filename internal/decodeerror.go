@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/schema"
+)
+
+// DecodeErrorHandlerContextKey is used to store a DecodeErrorHandler in the context.
+var DecodeErrorHandlerContextKey ctxKey = 4
+
+// DecodeErrorHandler is a callback type that you can register with ContextWithDecodeErrorHandler or WithDecodeErrorHandler to render input that couldn't be decoded.
+type DecodeErrorHandler func(r *http.Request, errs DecodeErrors) HttpResponse
+
+// DecodeError describes why (part of) the input couldn't be decoded.
+type DecodeError struct {
+	// Source is where the input came from: "path", "query", "header", "cookie", "form", "json" or "xml".
+	Source string `json:"source"`
+	// Field is the path of the field, like "address.zip". It's empty if the error isn't about a specific field, like a JSON syntax error.
+	Field string `json:"field,omitempty"`
+	// Value is the offending value, if known.
+	Value string `json:"value,omitempty"`
+	// Reason is a human readable description of the problem.
+	Reason string `json:"reason"`
+	// Err is the underlying error.
+	Err error `json:"-"`
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("failed to parse %s: %s", e.Source, e.Reason)
+	}
+	return fmt.Sprintf("failed to parse %s: %s: %s", e.Source, e.Field, e.Reason)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeErrors is a list of problems with the input of a request.
+type DecodeErrors []*DecodeError
+
+func (e DecodeErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, de := range e {
+		msgs[i] = de.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// schemaErrors converts an error from gorilla/schema into DecodeErrors.
+// sourceOf returns the source of a key in vm.
+func schemaErrors(err error, vm url.Values, sourceOf func(key string) string) error {
+	var me schema.MultiError
+	if !errors.As(err, &me) {
+		me = schema.MultiError{"": err}
+	}
+	keys := make([]string, 0, len(me))
+	for k := range me {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ret := make(DecodeErrors, 0, len(me))
+	for _, k := range keys {
+		de := &DecodeError{Source: sourceOf(k), Field: k, Err: me[k]}
+		var ce schema.ConversionError
+		var efe schema.EmptyFieldError
+		var uke schema.UnknownKeyError
+		switch {
+		case errors.As(me[k], &ce):
+			de.Field = ce.Key
+			de.Value = vm.Get(ce.Key)
+			if ce.Index >= 0 && len(vm[ce.Key]) > ce.Index {
+				de.Value = vm[ce.Key][ce.Index]
+			}
+			de.Reason = fmt.Sprintf("cannot convert %q to %s", de.Value, ce.Type)
+		case errors.As(me[k], &efe):
+			de.Field = efe.Key
+			de.Reason = "is required"
+		case errors.As(me[k], &uke):
+			de.Field = uke.Key
+			de.Value = vm.Get(uke.Key)
+			de.Reason = "is not a known field"
+		default:
+			de.Reason = me[k].Error()
+		}
+		ret = append(ret, de)
+	}
+	return ret
+}
+
+// sourceIs returns a function for schemaErrors that says all keys come from source.
+func sourceIs(source string) func(key string) string {
+	return func(key string) string {
+		return source
+	}
+}
+
+// bodyError converts an error from reading or parsing the input from source into DecodeErrors.
+// Errors from reading the body (like *http.MaxBytesError) are returned as is.
+func bodyError(source string, err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return err
+	}
+	de := &DecodeError{Source: source, Reason: err.Error(), Err: err}
+	var ute *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &ute):
+		de.Field = ute.Field
+		de.Value = ute.Value
+		de.Reason = fmt.Sprintf("cannot use %s as %s", ute.Value, ute.Type)
+	case err == io.EOF:
+		de.Reason = "body is empty"
+	case isUnknownFieldError(err):
+		de.Field, _ = strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		de.Reason = "is not a known field"
+	}
+	return DecodeErrors{de}
+}
+
+// isUnknownFieldError returns whether err is returned by a json.Decoder with DisallowUnknownFields for an unknown field.
+func isUnknownFieldError(err error) bool {
+	// encoding/json doesn't have an error type for this.
+	return strings.HasPrefix(err.Error(), "json: unknown field ")
+}
@@ -0,0 +1,298 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/schema"
+)
+
+// DecoderContextKey is used to store the Decoder in the context.
+var DecoderContextKey ctxKey = 6
+
+// Decoder decodes path, query, header, cookie and form values into input structs using github.com/gorilla/schema.
+// The settings must not be changed after the Decoder is first used.
+type Decoder struct {
+	// lenient and strict are configured identically, except for IgnoreUnknownKeys.
+	lenient, strict *schema.Decoder
+	aliasTag        string
+	maxSliceLength  int
+	commaSeparated  bool
+	sliceKeys       sync.Map // map[reflect.Type]map[string]bool
+	defaults        sync.Map // map[reflect.Type]url.Values
+}
+
+// Defaulter can be implemented by input types to set default values. Defaults is called before the input is decoded into it.
+type Defaulter interface {
+	Defaults()
+}
+
+// typeAndTag is used as a key for caches of information about struct types that depends on the alias tag.
+type typeAndTag struct {
+	t   reflect.Type
+	tag string
+}
+
+// DefaultDecoder is used if there's no Decoder in the context.
+var DefaultDecoder = NewDecoder()
+
+// NewDecoder returns a Decoder with the default settings and converters for time.Duration.
+// Types implementing encoding.TextUnmarshaler (like time.Time and net.IP) don't need a converter.
+func NewDecoder() *Decoder {
+	d := &Decoder{
+		lenient:  schema.NewDecoder(),
+		strict:   schema.NewDecoder(),
+		aliasTag: "schema",
+	}
+	d.lenient.IgnoreUnknownKeys(true)
+	d.RegisterConverter(time.Duration(0), func(s string) reflect.Value {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return reflect.Value{}
+		}
+		return reflect.ValueOf(v)
+	})
+	return d
+}
+
+// SetAliasTag changes the struct tag that holds the names of the fields. The default is "schema".
+func (d *Decoder) SetAliasTag(tag string) {
+	d.aliasTag = tag
+	d.lenient.SetAliasTag(tag)
+	d.strict.SetAliasTag(tag)
+}
+
+// ZeroEmpty makes empty values set fields to their zero value, rather than leaving them unchanged.
+func (d *Decoder) ZeroEmpty(z bool) {
+	d.lenient.ZeroEmpty(z)
+	d.strict.ZeroEmpty(z)
+}
+
+// RegisterConverter registers a function that converts strings to the type of value.
+// The converter returns an invalid reflect.Value if the string can't be converted.
+func (d *Decoder) RegisterConverter(value interface{}, f func(string) reflect.Value) {
+	d.lenient.RegisterConverter(value, f)
+	d.strict.RegisterConverter(value, f)
+}
+
+// MaxSliceLength limits the number of values a slice field can get, both through repeated keys and through indexes like `items.7.name`. Zero means unlimited.
+func (d *Decoder) MaxSliceLength(n int) {
+	d.maxSliceLength = n
+}
+
+// CommaSeparated makes values of slice fields be split on commas, so that `?ids=1,2,3` is the same as `?ids=1&ids=2&ids=3`.
+func (d *Decoder) CommaSeparated(c bool) {
+	d.commaSeparated = c
+}
+
+// decoderFrom returns the Decoder from the request context, or DefaultDecoder.
+func decoderFrom(r *http.Request) *Decoder {
+	if d, ok := r.Context().Value(DecoderContextKey).(*Decoder); ok {
+		return d
+	}
+	return DefaultDecoder
+}
+
+// decode decodes vm into ret, which is a pointer to a struct. If strict is set, unknown keys are rejected.
+// Fields that have no value in vm get the value of their `default` tag, and Defaults is called first if ret implements Defaulter.
+func (d *Decoder) decode(ret interface{}, vm url.Values, strict bool) error {
+	if df, ok := ret.(Defaulter); ok {
+		df.Defaults()
+	}
+	vm = d.withDefaults(reflect.TypeOf(ret).Elem(), vm)
+	if d.commaSeparated {
+		vm = d.splitCommas(reflect.TypeOf(ret).Elem(), vm)
+	}
+	if err := d.checkSliceLength(vm); err != nil {
+		return err
+	}
+	if strict {
+		return d.strict.Decode(ret, vm)
+	}
+	return d.lenient.Decode(ret, vm)
+}
+
+// checkSliceLength returns a schema.MultiError if vm would create slices longer than maxSliceLength.
+func (d *Decoder) checkSliceLength(vm url.Values) error {
+	if d.maxSliceLength <= 0 {
+		return nil
+	}
+	errs := schema.MultiError{}
+	for k, v := range vm {
+		if len(v) > d.maxSliceLength {
+			errs[k] = fmt.Errorf("has more than %d values", d.maxSliceLength)
+			continue
+		}
+		for _, p := range strings.Split(k, ".") {
+			if i, err := strconv.Atoi(p); err == nil && i >= d.maxSliceLength {
+				errs[k] = fmt.Errorf("index %d is out of range; the maximum is %d", i, d.maxSliceLength-1)
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// splitCommas returns a copy of vm in which the values for slice fields of t are split on commas.
+func (d *Decoder) splitCommas(t reflect.Type, vm url.Values) url.Values {
+	keys := d.getSliceKeys(t)
+	if len(keys) == 0 {
+		return vm
+	}
+	ret := url.Values{}
+	for k, v := range vm {
+		if !keys[strings.ToLower(k)] {
+			ret[k] = v
+			continue
+		}
+		for _, s := range v {
+			ret[k] = append(ret[k], strings.Split(s, ",")...)
+		}
+	}
+	return ret
+}
+
+// getSliceKeys returns the lowercased keys of the slice fields of t (and its nested structs).
+func (d *Decoder) getSliceKeys(t reflect.Type) map[string]bool {
+	if keys, ok := d.sliceKeys.Load(t); ok {
+		return keys.(map[string]bool)
+	}
+	keys := map[string]bool{}
+	d.addSliceKeys(keys, t, "")
+	d.sliceKeys.Store(t, keys)
+	return keys
+}
+
+// withDefaults returns a copy of vm to which the values of the `default` tags of t are added for keys that vm doesn't have.
+func (d *Decoder) withDefaults(t reflect.Type, vm url.Values) url.Values {
+	defaults := d.getDefaults(t)
+	if len(defaults) == 0 {
+		return vm
+	}
+	present := make(map[string]bool, len(vm))
+	ret := make(url.Values, len(vm)+len(defaults))
+	for k, v := range vm {
+		present[strings.ToLower(k)] = true
+		ret[k] = v
+	}
+	for k, v := range defaults {
+		if !present[strings.ToLower(k)] {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// getDefaults returns the values of the `default` tags of the fields of t (and its nested structs), by key.
+// Defaults of slice fields are split on commas.
+func (d *Decoder) getDefaults(t reflect.Type) url.Values {
+	if defaults, ok := d.defaults.Load(t); ok {
+		return defaults.(url.Values)
+	}
+	defaults := url.Values{}
+	d.addDefaults(defaults, t, "")
+	d.defaults.Store(t, defaults)
+	return defaults
+}
+
+func (d *Decoder) addDefaults(defaults url.Values, t reflect.Type, prefix string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; t.NumField() > i; i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get(d.aliasTag), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if def, ok := f.Tag.Lookup("default"); ok {
+			if ft.Kind() == reflect.Slice && !reflect.PtrTo(ft).Implements(textUnmarshalerType) {
+				defaults[prefix+name] = strings.Split(def, ",")
+			} else {
+				defaults[prefix+name] = []string{def}
+			}
+			continue
+		}
+		switch {
+		case reflect.PtrTo(ft).Implements(textUnmarshalerType):
+		case ft.Kind() == reflect.Struct && f.Anonymous:
+			d.addDefaults(defaults, ft, prefix)
+		case ft.Kind() == reflect.Struct:
+			d.addDefaults(defaults, ft, prefix+name+".")
+		}
+	}
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func (d *Decoder) addSliceKeys(keys map[string]bool, t reflect.Type, prefix string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; t.NumField() > i; i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get(d.aliasTag), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		switch {
+		case reflect.PtrTo(ft).Implements(textUnmarshalerType):
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Struct:
+			keys[strings.ToLower(prefix+name)] = true
+		case ft.Kind() == reflect.Struct && f.Anonymous:
+			d.addSliceKeys(keys, ft, prefix)
+		case ft.Kind() == reflect.Struct:
+			d.addSliceKeys(keys, ft, prefix+name+".")
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// SupportedEncodings are the Content-Encodings of request bodies that are decompressed.
+var SupportedEncodings = []string{"gzip", "deflate"}
+
+// UnsupportedEncodingError is returned if the request body has a Content-Encoding that can't be decompressed.
+type UnsupportedEncodingError struct {
+	Encoding string
+}
+
+func (e *UnsupportedEncodingError) Error() string {
+	return fmt.Sprintf("unsupported Content-Encoding %q; supported are %s", e.Encoding, strings.Join(SupportedEncodings, ", "))
+}
+
+// readCloser reads from a decompressor and closes the original body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// decompressBody returns the body of r decoded according to its Content-Encoding.
+// The decompressors are created lazily, so problems with the compressed data are reported by Read.
+func decompressBody(r *http.Request, body io.ReadCloser) (io.ReadCloser, bool, error) {
+	var encodings []string
+	for _, v := range r.Header.Values("Content-Encoding") {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.ToLower(strings.TrimSpace(e)); e != "" && e != "identity" {
+				encodings = append(encodings, e)
+			}
+		}
+	}
+	if len(encodings) == 0 {
+		return body, false, nil
+	}
+	var rd io.Reader = body
+	// Encodings are listed in the order they were applied, so they're undone in reverse.
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encodings[i] {
+		case "gzip", "x-gzip":
+			rd = &lazyReader{open: gzipOpener(rd)}
+		case "deflate":
+			rd = &lazyReader{open: deflateOpener(rd)}
+		default:
+			return nil, false, &UnsupportedEncodingError{Encoding: encodings[i]}
+		}
+	}
+	return readCloser{rd, body}, true, nil
+}
+
+func gzipOpener(rd io.Reader) func() (io.Reader, error) {
+	return func() (io.Reader, error) {
+		return gzip.NewReader(rd)
+	}
+}
+
+// deflateOpener accepts both the zlib format that HTTP specifies for deflate and raw deflate data that some clients send instead.
+func deflateOpener(rd io.Reader) func() (io.Reader, error) {
+	return func() (io.Reader, error) {
+		br := bufio.NewReader(rd)
+		h, err := br.Peek(2)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		// A zlib header uses compression method 8 and is a multiple of 31 (RFC 1950).
+		if len(h) == 2 && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+}
+
+// lazyReader creates its reader on the first Read.
+type lazyReader struct {
+	open func() (io.Reader, error)
+	r    io.Reader
+	err  error
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.r == nil && l.err == nil {
+		l.r, l.err = l.open()
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.r.Read(p)
+}
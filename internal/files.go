@@ -0,0 +1,254 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// UploadedFile is a file uploaded in a multipart form.
+// ContentType is sniffed from the contents with http.DetectContentType, so unlike the Content-Type header of the part it can't be chosen freely by the client.
+type UploadedFile struct {
+	*multipart.FileHeader
+	ContentType string
+}
+
+var (
+	fileHeaderType    = reflect.TypeOf(&multipart.FileHeader{})
+	fileHeadersType   = reflect.TypeOf([]*multipart.FileHeader{})
+	uploadedFileType  = reflect.TypeOf(&UploadedFile{})
+	uploadedFilesType = reflect.TypeOf([]*UploadedFile{})
+)
+
+// FileTooLargeError is returned if an uploaded file is larger than the maxsize of its field.
+type FileTooLargeError struct {
+	Field   string
+	Size    int64
+	MaxSize int64
+}
+
+func (e *FileTooLargeError) Error() string {
+	return fmt.Sprintf("file %s is %d bytes; the limit is %d bytes", e.Field, e.Size, e.MaxSize)
+}
+
+// FileTypeError is returned if an uploaded file doesn't have one of the types of its field.
+type FileTypeError struct {
+	Field       string
+	ContentType string
+	Accepted    []string
+}
+
+func (e *FileTypeError) Error() string {
+	return fmt.Sprintf("file %s is of type %q; expected %s", e.Field, e.ContentType, strings.Join(e.Accepted, ", "))
+}
+
+// fileField is a field of a form input struct that holds uploaded files.
+type fileField struct {
+	index []int
+	name  string
+	typ   reflect.Type
+	// maxSize is the maximum size of each file in bytes, or 0 if unlimited.
+	maxSize int64
+	// types are the accepted media types of the files, which may end in /* to accept all subtypes. Empty means any.
+	types []string
+}
+
+var fileFieldsCache sync.Map // map[typeAndTag][]fileField
+
+// CheckFiles returns an error if the `file` tags of the form input struct t are invalid.
+func CheckFiles(t reflect.Type) error {
+	_, err := getFileFields(t, "schema")
+	return err
+}
+
+// getFileFields returns the file fields of t. Their names are read from the aliasTag.
+func getFileFields(t reflect.Type, aliasTag string) ([]fileField, error) {
+	key := typeAndTag{t, aliasTag}
+	if ff, ok := fileFieldsCache.Load(key); ok {
+		return ff.([]fileField), nil
+	}
+	ff, err := newFileFields(t, aliasTag)
+	if err != nil {
+		return nil, err
+	}
+	fileFieldsCache.Store(key, ff)
+	return ff, nil
+}
+
+func newFileFields(t reflect.Type, aliasTag string) ([]fileField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	var ret []fileField
+	for i := 0; t.NumField() > i; i++ {
+		f := t.Field(i)
+		switch f.Type {
+		case fileHeaderType, fileHeadersType, uploadedFileType, uploadedFilesType:
+		default:
+			if _, ok := f.Tag.Lookup("file"); ok {
+				return nil, fmt.Errorf("%s.%s is tagged with `file`, but isn't a *multipart.FileHeader, *convreq.UploadedFile or a slice of those", t, f.Name)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		ff := fileField{
+			index: f.Index,
+			name:  strings.Split(f.Tag.Get(aliasTag), ",")[0],
+			typ:   f.Type,
+		}
+		if ff.name == "" {
+			ff.name = f.Name
+		}
+		if tag := f.Tag.Get("file"); tag != "" {
+			for _, opt := range strings.Split(tag, ",") {
+				k, v, _ := strings.Cut(opt, "=")
+				switch k {
+				case "maxsize":
+					n, err := strconv.ParseInt(v, 10, 64)
+					if err != nil || n <= 0 {
+						return nil, fmt.Errorf("%s.%s: invalid maxsize %q", t, f.Name, v)
+					}
+					ff.maxSize = n
+				case "types":
+					ff.types = strings.Fields(v)
+				default:
+					return nil, fmt.Errorf("%s.%s: unknown file option %q", t, f.Name, k)
+				}
+			}
+		}
+		ret = append(ret, ff)
+	}
+	return ret, nil
+}
+
+// withoutFileKeys returns vm without values that would be decoded by gorilla/schema into the file fields ff.
+func withoutFileKeys(vm url.Values, ff []fileField) url.Values {
+	if len(ff) == 0 {
+		return vm
+	}
+	ret := url.Values{}
+	for k, v := range vm {
+		ret[k] = v
+	}
+	for k := range vm {
+		for _, f := range ff {
+			if strings.EqualFold(k, f.name) || (len(k) > len(f.name) && strings.EqualFold(k[:len(f.name)+1], f.name+".")) {
+				delete(ret, k)
+			}
+		}
+	}
+	return ret
+}
+
+// decodeFiles sets the file fields ff of the struct v from the parsed multipart form of r.
+func decodeFiles(r *http.Request, v reflect.Value, ff []fileField) error {
+	for _, f := range ff {
+		var headers []*multipart.FileHeader
+		if r.MultipartForm != nil {
+			headers = r.MultipartForm.File[f.name]
+			if headers == nil {
+				for k, h := range r.MultipartForm.File {
+					if strings.EqualFold(k, f.name) {
+						headers = h
+						break
+					}
+				}
+			}
+		}
+		files := make([]*UploadedFile, len(headers))
+		for i, h := range headers {
+			uf, err := f.check(h)
+			if err != nil {
+				return err
+			}
+			files[i] = uf
+		}
+		fv := v.FieldByIndex(f.index)
+		switch f.typ {
+		case fileHeaderType:
+			if len(headers) > 0 {
+				fv.Set(reflect.ValueOf(headers[0]))
+			} else {
+				fv.Set(reflect.Zero(f.typ))
+			}
+		case fileHeadersType:
+			fv.Set(reflect.ValueOf(headers))
+		case uploadedFileType:
+			if len(files) > 0 {
+				fv.Set(reflect.ValueOf(files[0]))
+			} else {
+				fv.Set(reflect.Zero(f.typ))
+			}
+		case uploadedFilesType:
+			if len(files) == 0 {
+				files = nil
+			}
+			fv.Set(reflect.ValueOf(files))
+		}
+	}
+	return nil
+}
+
+// check checks h against the constraints of f and returns it as an UploadedFile.
+func (f fileField) check(h *multipart.FileHeader) (*UploadedFile, error) {
+	if f.maxSize > 0 && h.Size > f.maxSize {
+		return nil, &FileTooLargeError{Field: f.name, Size: h.Size, MaxSize: f.maxSize}
+	}
+	uf := &UploadedFile{FileHeader: h}
+	if len(f.types) == 0 && f.typ != uploadedFileType && f.typ != uploadedFilesType {
+		return uf, nil
+	}
+	ct, err := sniffContentType(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", f.name, err)
+	}
+	uf.ContentType = ct
+	if len(f.types) == 0 {
+		return uf, nil
+	}
+	mt, _, _ := mime.ParseMediaType(ct)
+	for _, t := range f.types {
+		if t == mt || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, t[:len(t)-1])) {
+			return uf, nil
+		}
+	}
+	return nil, &FileTypeError{Field: f.name, ContentType: mt, Accepted: f.types}
+}
+
+// sniffContentType returns the media type of the uploaded file, based on its first 512 bytes.
+func sniffContentType(h *multipart.FileHeader) (string, error) {
+	f, err := h.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// UnauthorizedError is returned if a field marked with the `unauthorized` tag option (like `schema:"Authorization,required,unauthorized"`) couldn't be decoded.
+type UnauthorizedError struct {
+	DecodeErrors
+}
+
+// DecodeHeaders decodes the request headers into `ret` using github.com/gorilla/schema. Field names are matched case-insensitively against the header names.
+func DecodeHeaders(r *http.Request, ret interface{}) error {
+	vm := url.Values{}
+	for k, v := range r.Header {
+		vm[k] = v
+	}
+	return decodeValues(r, ret, vm, "header")
+}
+
+// DecodeCookies decodes the request cookies into `ret` using github.com/gorilla/schema.
+func DecodeCookies(r *http.Request, ret interface{}) error {
+	vm := url.Values{}
+	for _, c := range r.Cookies() {
+		vm[c.Name] = append(vm[c.Name], c.Value)
+	}
+	return decodeValues(r, ret, vm, "cookie")
+}
+
+// decodeValues decodes vm from source into ret. Unknown keys are always ignored, as requests have many headers and cookies that aren't meant for us.
+func decodeValues(r *http.Request, ret interface{}, vm url.Values, source string) error {
+	d := decoderFrom(r)
+	if err := d.decode(ret, vm, false); err != nil {
+		return d.unauthorized(reflect.TypeOf(ret).Elem(), schemaErrors(err, vm, sourceIs(source)))
+	}
+	return nil
+}
+
+var unauthorizedKeysCache sync.Map // map[typeAndTag]map[string]bool
+
+// unauthorized wraps err in an UnauthorizedError if it's about one of the fields of t marked with the `unauthorized` tag option.
+func (d *Decoder) unauthorized(t reflect.Type, err error) error {
+	var des DecodeErrors
+	if !errors.As(err, &des) {
+		return err
+	}
+	keys := d.getUnauthorizedKeys(t)
+	for _, de := range des {
+		if keys[strings.ToLower(de.Field)] {
+			return &UnauthorizedError{des}
+		}
+	}
+	return err
+}
+
+// getUnauthorizedKeys returns the lowercased names of the fields of t marked with the `unauthorized` tag option.
+func (d *Decoder) getUnauthorizedKeys(t reflect.Type) map[string]bool {
+	key := typeAndTag{t, d.aliasTag}
+	if keys, ok := unauthorizedKeysCache.Load(key); ok {
+		return keys.(map[string]bool)
+	}
+	keys := map[string]bool{}
+	for i := 0; t.NumField() > i; i++ {
+		f := t.Field(i)
+		opts := strings.Split(f.Tag.Get(d.aliasTag), ",")
+		for _, o := range opts[1:] {
+			if o == "unauthorized" {
+				name := opts[0]
+				if name == "" {
+					name = f.Name
+				}
+				keys[strings.ToLower(name)] = true
+			}
+		}
+	}
+	unauthorizedKeysCache.Store(key, keys)
+	return keys
+}
+
+// LastEventID is the ID of the last Server-Sent Event a reconnecting client received, from the Last-Event-ID header. It's empty on the first connection.
+type LastEventID string
+
+// DecodeLastEventID returns the Last-Event-ID header of the request.
+func DecodeLastEventID(r *http.Request) (LastEventID, error) {
+	return LastEventID(r.Header.Get("Last-Event-ID")), nil
+}
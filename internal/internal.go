@@ -15,22 +15,14 @@
 package internal
 
 import (
-	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"reflect"
 
 	"github.com/gorilla/mux"
-	"github.com/gorilla/schema"
 )
 
-var decoder = func() *schema.Decoder {
-	d := schema.NewDecoder()
-	d.IgnoreUnknownKeys(true)
-	return d
-}()
-
 // HttpResponse is what is to be returned from request handlers.
 // Respond gets executed to write the response to the client.
 type HttpResponse interface {
@@ -45,51 +37,133 @@ var ErrorHandlerContextKey ctxKey = 1
 // ErrorHandler is a callback type that you can register with ContextWithErrorHandler or WithErrorHandler to have your own callback called to render errors.
 type ErrorHandler func(code int, msg string, r *http.Request) HttpResponse
 
+// PanicHandlerContextKey is used to store a PanicHandler in the context.
+var PanicHandlerContextKey ctxKey = 2
+
+// PanicHandler is a callback type that you can register with ContextWithPanicHandler or WithPanicHandler to decide what to respond when a request handler panics.
+// p is the value that was recovered.
+type PanicHandler func(r *http.Request, p interface{}) HttpResponse
+
+// ResponseErrorHandlerContextKey is used to store a ResponseErrorHandler in the context.
+var ResponseErrorHandlerContextKey ctxKey = 8
+
+// ResponseErrorHandler is a callback type that you can register with ContextWithResponseErrorHandler or WithResponseErrorHandler to be told about errors writing a response, like a stream that fails halfway.
+// The response can't be changed anymore at that point, so it's meant for logging and metrics.
+type ResponseErrorHandler func(r *http.Request, err error)
+
 // DoRespond executes a HttpResponse and has it write to the ResponseWriter.
+// A nil HttpResponse (including a nil pointer of a type implementing it) doesn't write anything, just like a request handler without return value.
+// Errors from Respond are passed to the ResponseErrorHandler in the context, or logged.
 func DoRespond(w http.ResponseWriter, r *http.Request, hr HttpResponse) {
+	if IsNilResponse(hr) {
+		return
+	}
 	if err := hr.Respond(w, r); err != nil {
+		if f, ok := r.Context().Value(ResponseErrorHandlerContextKey).(ResponseErrorHandler); ok {
+			f(r, err)
+			return
+		}
 		log.Printf("Failed to respond to request: %v", err)
 	}
 }
 
+// IsNilResponse returns whether hr is nil, or a non-nil interface holding a nil pointer, map, slice or func.
+func IsNilResponse(hr HttpResponse) bool {
+	if hr == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(hr); v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
 // DecodeGet parses the GET parameters of the request into `ret` using github.com/gorilla/schema.
 func DecodeGet(r *http.Request, ret interface{}) error {
 	vm, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
-		return fmt.Errorf("failed to parse query: %v", err)
+		return DecodeErrors{{Source: "query", Reason: err.Error(), Err: err}}
 	}
-	for k, v := range mux.Vars(r) {
+	vars := mux.Vars(r)
+	for k, v := range vars {
 		vm.Set(k, v)
 	}
-	if err := decoder.Decode(ret, vm); err != nil {
-		return fmt.Errorf("failed to parse url/query: %v", err)
+	// Path variables don't need to be in the struct, even in strict mode.
+	if err := allowKeys(decoderFrom(r).decode(ret, vm, isStrict(r, ret)), vars); err != nil {
+		return schemaErrors(err, vm, func(key string) string {
+			if _, ok := vars[key]; ok {
+				return "path"
+			}
+			return "query"
+		})
 	}
 	return nil
 }
 
 // DecodePost parses the POST parameters of the request into `ret` using github.com/gorilla/schema.
 func DecodePost(r *http.Request, ret interface{}) error {
-	if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart { // 32MB. The value comes from net/http.defaultMaxMemory.
-		return fmt.Errorf("failed to parse form input: %v", err)
+	return DecodeForm(r, ret)
+}
+
+// DecodeForm parses the form in the request body into `ret` using github.com/gorilla/schema.
+// Unlike net/http, it also parses bodies of DELETE requests.
+// Fields of type *multipart.FileHeader, *UploadedFile or slices of those are set to the uploaded files.
+func DecodeForm(r *http.Request, ret interface{}) error {
+	d := decoderFrom(r)
+	ff, err := getFileFields(reflect.TypeOf(ret).Elem(), d.aliasTag)
+	if err != nil {
+		return err
 	}
-	if err := decoder.Decode(ret, r.PostForm); err != nil {
-		return fmt.Errorf("failed to parse form input: %v", err)
+	if err := limitBody(r, ret); err != nil {
+		return err
+	}
+	if err := parseForm(r); err != nil {
+		return bodyError("form", err)
+	}
+	vm := withoutFileKeys(r.PostForm, ff)
+	if err := d.decode(ret, vm, isStrict(r, ret)); err != nil {
+		return schemaErrors(err, vm, sourceIs("form"))
+	}
+	return decodeFiles(r, reflect.ValueOf(ret).Elem(), ff)
+}
+
+// parseForm parses the request body as a (multipart) form.
+func parseForm(r *http.Request) error {
+	if r.Method == "DELETE" && r.PostForm == nil {
+		// net/http only parses the body for POST, PUT and PATCH requests. Parse a shallow copy with another method, as others might be looking at r.Method concurrently.
+		rc := *r
+		rc.Method = "POST"
+		err := parseFormBody(&rc)
+		r.Form, r.PostForm, r.MultipartForm = rc.Form, rc.PostForm, rc.MultipartForm
+		return err
+	}
+	return parseFormBody(r)
+}
+
+func parseFormBody(r *http.Request) error {
+	// ParseMultipartForm drops errors from ParseForm if the body isn't multipart, so call it ourselves first.
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	if err := r.ParseMultipartForm(BodyLimitsFromContext(r.Context()).MaxMultipartMemory); err != nil && err != http.ErrNotMultipart {
+		return err
 	}
 	return nil
 }
 
 // DecodeJSON parses the request body into `ret` as JSON.
+// The Content-Type must be application/json, text/json or application/*+json.
 func DecodeJSON(r *http.Request, ret interface{}) error {
-	switch r.Header.Get("Content-Type") {
-	case "text/json", "application/json":
-	case "":
-		return fmt.Errorf("expected Content-Type: text/json rather than unset")
-	default:
-		return fmt.Errorf("expected Content-Type: text/json rather than %q", r.Header.Get("Content-Type"))
+	return decodeJSON(r, ret, isStrict(r, ret))
+}
+
+func decodeJSON(r *http.Request, ret interface{}, strict bool) error {
+	if mt := mediaType(r); !isJSON(mt) {
+		return &UnsupportedMediaTypeError{MediaType: mt, Accepted: []string{"application/json"}}
 	}
-	defer r.Body.Close()
-	if err := json.NewDecoder(r.Body).Decode(ret); err != nil {
-		return fmt.Errorf("failed to decode json body: %v", err)
+	if err := limitBody(r, ret); err != nil {
+		return err
 	}
-	return nil
+	return readJSON(r, ret, strict)
 }
@@ -0,0 +1,195 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxRecordSize is the default maximum size of a single record in a JSONRecords stream.
+const DefaultMaxRecordSize = 1 << 20 // 1MB
+
+// ndjsonTypes are the media types for newline delimited JSON.
+var ndjsonTypes = map[string]bool{
+	"application/x-ndjson":    true,
+	"application/ndjson":      true,
+	"application/jsonl":       true,
+	"application/x-jsonlines": true,
+}
+
+// RecordError is returned for a record in a JSON stream that couldn't be decoded or isn't valid. The stream continues with the next record.
+type RecordError struct {
+	// Index is the index of the record in the stream, starting at 0.
+	Index int
+	// Err is DecodeErrors or FieldErrors.
+	Err error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Index, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// RecordTooLargeError is returned if a record in a JSON stream is larger than the maximum record size.
+type RecordTooLargeError struct {
+	Index int
+	Limit int64
+}
+
+func (e *RecordTooLargeError) Error() string {
+	return fmt.Sprintf("record %d is larger than %d bytes", e.Index, e.Limit)
+}
+
+var errRecordTooLarge = errors.New("record too large")
+
+// recordLimiter limits the number of bytes read since the last reset.
+// As json.Decoder reads ahead, this is an approximation of the size of the current record that bounds the memory used.
+type recordLimiter struct {
+	r    io.Reader
+	read int64
+	max  int64
+}
+
+func (l *recordLimiter) Read(p []byte) (int, error) {
+	if l.max > 0 {
+		if l.read >= l.max {
+			return 0, errRecordTooLarge
+		}
+		if int64(len(p)) > l.max-l.read {
+			p = p[:l.max-l.read]
+		}
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	return n, err
+}
+
+// JSONRecords reads records from a request body that is either a JSON array or newline delimited JSON.
+type JSONRecords struct {
+	ctx     context.Context
+	dec     *json.Decoder
+	limiter *recordLimiter
+	array   bool
+	index   int
+	done    bool
+	err     error
+}
+
+// NewJSONRecords returns a JSONRecords for the request body. rec is a pointer to a record, and is only used to see whether it implements StrictDecoder.
+// The Content-Type must be a JSON media type (for an array of records) or one of the types for newline delimited JSON, like application/x-ndjson.
+func NewJSONRecords(r *http.Request, rec interface{}) (*JSONRecords, error) {
+	mt := mediaType(r)
+	if !isJSON(mt) && !ndjsonTypes[mt] {
+		return nil, &UnsupportedMediaTypeError{MediaType: mt, Accepted: []string{"application/json", "application/x-ndjson"}}
+	}
+	if err := limitBody(r, nil); err != nil {
+		return nil, err
+	}
+	s := &JSONRecords{
+		ctx:     r.Context(),
+		limiter: &recordLimiter{r: r.Body, max: DefaultMaxRecordSize},
+		array:   isJSON(mt),
+		index:   -1,
+	}
+	s.dec = json.NewDecoder(s.limiter)
+	if isStrict(r, rec) {
+		s.dec.DisallowUnknownFields()
+	}
+	if s.array {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return nil, bodyError("json", err)
+		}
+		if tok != json.Delim('[') {
+			return nil, DecodeErrors{{Source: "json", Reason: fmt.Sprintf("expected an array, got %v", tok)}}
+		}
+	}
+	return s, nil
+}
+
+// SetMaxRecordSize changes the maximum size of a single record. Zero means unlimited.
+func (s *JSONRecords) SetMaxRecordSize(n int64) {
+	s.limiter.max = n
+}
+
+// Next decodes the next record into v. It returns false at the end of the stream or if the stream can't be read any further, in which case Err returns why.
+// A *RecordError is returned if just this record couldn't be decoded or isn't valid.
+func (s *JSONRecords) Next(v interface{}) (bool, error) {
+	if s.done || s.err != nil {
+		return false, nil
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return false, nil
+	}
+	s.limiter.read = 0
+	if !s.dec.More() {
+		s.done = true
+		s.err = s.finish()
+		return false, nil
+	}
+	s.index++
+	if err := s.dec.Decode(v); err != nil {
+		var ute *json.UnmarshalTypeError
+		switch {
+		case errors.Is(err, errRecordTooLarge):
+			s.err = &RecordTooLargeError{Index: s.index, Limit: s.limiter.max}
+			return false, nil
+		case errors.As(err, &ute), isUnknownFieldError(err):
+			// The decoder has consumed the whole record, so we can continue with the next one.
+			return true, &RecordError{Index: s.index, Err: bodyError("json", err)}
+		}
+		s.err = bodyError("json", err)
+		return false, nil
+	}
+	if errs := Validate(v); errs != nil {
+		return true, &RecordError{Index: s.index, Err: errs}
+	}
+	return true, nil
+}
+
+// finish checks that the stream ends properly after the last record.
+func (s *JSONRecords) finish() error {
+	if s.array {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return bodyError("json", err)
+		}
+		if tok != json.Delim(']') {
+			return DecodeErrors{{Source: "json", Reason: fmt.Sprintf("expected the end of the array, got %v", tok)}}
+		}
+	}
+	tok, err := s.dec.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return bodyError("json", err)
+	}
+	return DecodeErrors{{Source: "json", Reason: fmt.Sprintf("unexpected %v after the last record", tok)}}
+}
+
+// Err returns the error that stopped the stream, if any. It's nil if the stream was read until the end.
+func (s *JSONRecords) Err() error {
+	return s.err
+}
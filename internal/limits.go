@@ -0,0 +1,105 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// BodyLimitsContextKey is used to store BodyLimits in the context.
+var BodyLimitsContextKey ctxKey = 3
+
+// BodyLimits limits how much of the request body the decoders will read.
+type BodyLimits struct {
+	// MaxBodySize is the maximum size in bytes of request bodies that aren't multipart forms. A negative value means unlimited.
+	MaxBodySize int64
+	// MaxMultipartSize is the maximum size in bytes of multipart/form-data request bodies, including the files that are stored on disk. A negative value means unlimited.
+	MaxMultipartSize int64
+	// MaxMultipartMemory is how many bytes of a multipart form are kept in memory. The remainder of the files is stored in temporary files on disk.
+	MaxMultipartMemory int64
+	// MaxMultipartParts is the maximum number of parts of a multipart form read by a MultipartStream. Zero means unlimited.
+	MaxMultipartParts int
+}
+
+// DefaultBodyLimits are used if there are no BodyLimits in the context.
+var DefaultBodyLimits = BodyLimits{
+	MaxBodySize: 10 << 20, // 10MB, like net/http's limit for url-encoded forms.
+	// Multipart forms carry uploads, so they get more room. Only MaxMultipartMemory of them is kept in memory.
+	MaxMultipartSize:   100 << 20, // 100MB.
+	MaxMultipartMemory: 32 << 20, // 32MB. The value comes from net/http.defaultMaxMemory.
+	MaxMultipartParts:  1000,
+}
+
+// BodyLimitsFromContext returns the BodyLimits stored in ctx, or DefaultBodyLimits.
+func BodyLimitsFromContext(ctx context.Context) BodyLimits {
+	if l, ok := ctx.Value(BodyLimitsContextKey).(BodyLimits); ok {
+		return l
+	}
+	return DefaultBodyLimits
+}
+
+// MaxBodySizer can be implemented by input types to override BodyLimits.MaxBodySize (or MaxMultipartSize) for requests they're decoded from.
+type MaxBodySizer interface {
+	MaxBodySize() int64
+}
+
+// limitedBody marks request bodies that limitBody has already been applied to.
+type limitedBody struct {
+	io.ReadCloser
+}
+
+// limitBody limits the request body to the MaxBodySize of ret, or that of the BodyLimits in the context (MaxMultipartSize for multipart forms). ret may be nil.
+// A body with a Content-Encoding is decompressed, and the limit applies both before and after decompression to stop zip bombs.
+// If the limit is unlimited, the decompressed body is still limited to MaxBodySize.
+// Only the first call for a request has effect, so all decoders can call it.
+func limitBody(r *http.Request, ret interface{}) error {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	if _, ok := r.Body.(limitedBody); ok {
+		return nil
+	}
+	l := BodyLimitsFromContext(r.Context())
+	n := l.MaxBodySize
+	if mediaType(r) == "multipart/form-data" {
+		n = l.MaxMultipartSize
+	}
+	if m, ok := ret.(MaxBodySizer); ok {
+		n = m.MaxBodySize()
+	}
+	body := r.Body
+	if n >= 0 {
+		body = http.MaxBytesReader(nil, body, n)
+	}
+	body, decompressed, err := decompressBody(r, body)
+	if err != nil {
+		return err
+	}
+	if decompressed {
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+		if n < 0 {
+			n = l.MaxBodySize
+		}
+		if n >= 0 {
+			body = http.MaxBytesReader(nil, body, n)
+		}
+	}
+	r.Body = limitedBody{body}
+	return nil
+}
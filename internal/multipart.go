@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// MultipartLimitError is returned if a streamed multipart form exceeds one of the BodyLimits.
+type MultipartLimitError struct {
+	Reason string
+}
+
+func (e *MultipartLimitError) Error() string {
+	return e.Reason
+}
+
+// MultipartStream reads the parts of a multipart form one by one, without buffering them like http.Request.ParseMultipartForm does.
+type MultipartStream struct {
+	mr      *multipart.Reader
+	limits  BodyLimits
+	decoder *Decoder
+	strict  bool
+	parts   int
+	// next is a part that was read by DecodeFields, to be returned by the next call to NextPart.
+	next *multipart.Part
+}
+
+// NewMultipartStream returns a MultipartStream for the request body, which must be multipart/form-data.
+// The body is limited to the MaxMultipartSize and the number of parts to the MaxMultipartParts of the BodyLimits in the context.
+func NewMultipartStream(r *http.Request) (*MultipartStream, error) {
+	if mt := mediaType(r); mt != "multipart/form-data" {
+		return nil, &UnsupportedMediaTypeError{MediaType: mt, Accepted: []string{"multipart/form-data"}}
+	}
+	if err := limitBody(r, nil); err != nil {
+		return nil, err
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse multipart form: %w", err)
+	}
+	return &MultipartStream{mr: mr, limits: BodyLimitsFromContext(r.Context()), decoder: decoderFrom(r), strict: isStrict(r, nil)}, nil
+}
+
+// NextPart returns the next part of the form, or io.EOF if there are no more parts.
+// The part is only valid until the next call to NextPart.
+func (s *MultipartStream) NextPart() (*multipart.Part, error) {
+	if p := s.next; p != nil {
+		s.next = nil
+		return p, nil
+	}
+	p, err := s.mr.NextPart()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse multipart form: %w", err)
+	}
+	s.parts++
+	if s.limits.MaxMultipartParts > 0 && s.parts > s.limits.MaxMultipartParts {
+		return nil, &MultipartLimitError{fmt.Sprintf("multipart form has more than %d parts", s.limits.MaxMultipartParts)}
+	}
+	return p, nil
+}
+
+// DecodeFields reads the parts up to the first file, and decodes them into `ret` using github.com/gorilla/schema.
+// The file is returned by the next call to NextPart. The fields together may be at most MaxMultipartMemory bytes.
+// The result is validated like other input structs, so the returned error might be FieldErrors.
+func (s *MultipartStream) DecodeFields(ret interface{}) error {
+	vm := url.Values{}
+	remaining := s.limits.MaxMultipartMemory
+	for {
+		p, err := s.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if p.FileName() != "" {
+			s.next = p
+			break
+		}
+		b, err := io.ReadAll(io.LimitReader(p, remaining+1))
+		if err != nil {
+			return fmt.Errorf("failed to parse multipart form: %w", err)
+		}
+		remaining -= int64(len(b))
+		if remaining < 0 {
+			return &MultipartLimitError{fmt.Sprintf("multipart form fields are larger than %d bytes", s.limits.MaxMultipartMemory)}
+		}
+		vm.Add(p.FormName(), string(b))
+	}
+	strict := s.strict
+	if sd, ok := ret.(StrictDecoder); ok {
+		strict = sd.StrictDecoding()
+	}
+	if err := s.decoder.decode(ret, vm, strict); err != nil {
+		return schemaErrors(err, vm, sourceIs("form"))
+	}
+	if errs := Validate(ret); errs != nil {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// PageOptionsContextKey is used to store PageOptions in the context.
+var PageOptionsContextKey ctxKey = 7
+
+// PageOptions configures how a Page is decoded from the query parameters limit, offset and cursor.
+type PageOptions struct {
+	// DefaultLimit is the limit if the request doesn't have one. If it's zero, the DefaultLimit of DefaultPageOptions is used.
+	DefaultLimit int
+	// MaxLimit is the highest limit. Higher limits are lowered to MaxLimit. If it's zero, the MaxLimit of DefaultPageOptions is used, and a negative value means there is no maximum.
+	MaxLimit int
+	// CursorKey is the key cursors are signed with, so clients can't forge them. It must be the same for all replicas and survive restarts.
+	// Cursors can't be used without it: building the URL of a cursor page fails, and cursors in requests are invalid.
+	CursorKey []byte
+}
+
+// DefaultPageOptions are used if there are no PageOptions in the context.
+var DefaultPageOptions = PageOptions{
+	DefaultLimit: 50,
+	MaxLimit:     100,
+}
+
+// errNoCursorKey is returned when a cursor is signed without a CursorKey.
+var errNoCursorKey = errors.New("can't sign a page cursor without PageOptions.CursorKey")
+
+// PageOptionsFromContext returns the PageOptions stored in ctx, or DefaultPageOptions. Zero limits are replaced by those of DefaultPageOptions.
+func PageOptionsFromContext(ctx context.Context) PageOptions {
+	o, ok := ctx.Value(PageOptionsContextKey).(PageOptions)
+	if !ok {
+		return DefaultPageOptions
+	}
+	if o.DefaultLimit <= 0 {
+		o.DefaultLimit = DefaultPageOptions.DefaultLimit
+	}
+	if o.MaxLimit == 0 {
+		o.MaxLimit = DefaultPageOptions.MaxLimit
+	}
+	return o
+}
+
+// Page is a page of a list, selected with the query parameters limit and either offset or cursor.
+type Page struct {
+	// Limit is the maximum number of items on the page. It's at least 1 and at most the MaxLimit.
+	Limit int
+	// Offset is the number of items to skip.
+	Offset int
+	// Cursor is the cursor given to NextCursor for the previous page, or empty if there's no cursor.
+	Cursor string
+}
+
+// Next returns the page after p, using offsets.
+func (p Page) Next() *Page {
+	return &Page{Limit: p.Limit, Offset: p.Offset + p.Limit}
+}
+
+// NextCursor returns the page after p, starting at the given cursor. The cursor is signed when it's put in a URL, so it can be trusted when it comes back.
+func (p Page) NextCursor(cursor string) *Page {
+	return &Page{Limit: p.Limit, Cursor: cursor}
+}
+
+// prev returns the page before p, or nil if p is the first page or uses a cursor.
+func (p Page) prev() *Page {
+	if p.Cursor != "" || p.Offset == 0 {
+		return nil
+	}
+	off := p.Offset - p.Limit
+	if off < 0 {
+		off = 0
+	}
+	return &Page{Limit: p.Limit, Offset: off}
+}
+
+// DecodePage decodes a Page from the query parameters of the request.
+func DecodePage(r *http.Request) (Page, error) {
+	opts := PageOptionsFromContext(r.Context())
+	q := r.URL.Query()
+	p := Page{Limit: opts.DefaultLimit}
+	var errs DecodeErrors
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		switch {
+		case err != nil:
+			errs = append(errs, &DecodeError{Source: "query", Field: "limit", Value: v, Reason: "is not a number", Err: err})
+		case n < 1:
+			errs = append(errs, &DecodeError{Source: "query", Field: "limit", Value: v, Reason: "must be at least 1"})
+		default:
+			p.Limit = n
+		}
+	}
+	if opts.MaxLimit > 0 && p.Limit > opts.MaxLimit {
+		p.Limit = opts.MaxLimit
+	}
+	if p.Limit < 1 {
+		p.Limit = 1
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		switch {
+		case err != nil:
+			errs = append(errs, &DecodeError{Source: "query", Field: "offset", Value: v, Reason: "is not a number", Err: err})
+		case n < 0:
+			errs = append(errs, &DecodeError{Source: "query", Field: "offset", Value: v, Reason: "must not be negative"})
+		default:
+			p.Offset = n
+		}
+	}
+	if v := q.Get("cursor"); v != "" {
+		c, ok := opts.verifyCursor(v)
+		if !ok {
+			errs = append(errs, &DecodeError{Source: "query", Field: "cursor", Value: v, Reason: "is invalid"})
+		}
+		p.Cursor = c
+	}
+	if errs != nil {
+		return Page{}, errs
+	}
+	return p, nil
+}
+
+// signCursor returns the cursor followed by its signature. It fails if there's no CursorKey.
+func (o PageOptions) signCursor(cursor string) (string, error) {
+	if len(o.CursorKey) == 0 {
+		return "", errNoCursorKey
+	}
+	mac := hmac.New(sha256.New, o.CursorKey)
+	mac.Write([]byte(cursor))
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyCursor returns the cursor signed by signCursor, and whether the signature is valid. Without a CursorKey no cursor is valid.
+func (o PageOptions) verifyCursor(signed string) (string, bool) {
+	c, sig, ok := strings.Cut(signed, ".")
+	if !ok || len(o.CursorKey) == 0 {
+		return "", false
+	}
+	cursor, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return "", false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, o.CursorKey)
+	mac.Write(cursor)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return "", false
+	}
+	return string(cursor), true
+}
+
+// URL returns the (relative) URL of page p of the list requested by r. Other query parameters are kept in their original order.
+// If r was routed by github.com/gorilla/mux, the path is built from its route.
+// It fails for pages with a cursor if the PageOptions have no CursorKey.
+func (p Page) URL(r *http.Request) (*url.URL, error) {
+	u := &url.URL{Path: r.URL.Path, RawPath: r.URL.RawPath}
+	skip := map[string]bool{"limit": true, "offset": true, "cursor": true}
+	var query []string
+	if route := mux.CurrentRoute(r); route != nil {
+		vars := url.Values{}
+		for k, v := range mux.Vars(r) {
+			vars.Set(k, v)
+		}
+		if ru, err := RouteURL(route, vars); err == nil {
+			u.Path = ru.Path
+			u.RawPath = ru.RawPath
+			if ru.RawQuery != "" {
+				query = append(query, ru.RawQuery)
+			}
+			_, queryKeys := routeVars(route)
+			for _, k := range queryKeys {
+				skip[k] = true
+			}
+		}
+	}
+	for _, kv := range strings.Split(r.URL.RawQuery, "&") {
+		k, _, _ := strings.Cut(kv, "=")
+		if k, err := url.QueryUnescape(k); kv == "" || err != nil || skip[k] {
+			continue
+		}
+		query = append(query, kv)
+	}
+	pq := url.Values{}
+	pq.Set("limit", strconv.Itoa(p.Limit))
+	if p.Cursor != "" {
+		c, err := PageOptionsFromContext(r.Context()).signCursor(p.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		pq.Set("cursor", c)
+	} else if p.Offset > 0 {
+		pq.Set("offset", strconv.Itoa(p.Offset))
+	}
+	u.RawQuery = strings.Join(append(query, pq.Encode()), "&")
+	return u, nil
+}
+
+// PageLinks returns the RFC 8288 Link header value for the next page and the page before the one requested by r. next may be nil.
+func PageLinks(r *http.Request, next *Page) (string, error) {
+	var links []string
+	if next != nil {
+		u, err := next.URL(r)
+		if err != nil {
+			return "", err
+		}
+		links = append(links, "<"+u.String()+`>; rel="next"`)
+	}
+	if cur, err := DecodePage(r); err == nil {
+		if prev := cur.prev(); prev != nil {
+			u, err := prev.URL(r)
+			if err != nil {
+				return "", err
+			}
+			links = append(links, "<"+u.String()+`>; rel="prev"`)
+		}
+	}
+	return strings.Join(links, ", "), nil
+}
@@ -0,0 +1,541 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// Patch is a change to a value, like a MergePatch or a JSONPatch.
+type Patch interface {
+	// Apply applies the patch to target, which must be a pointer. target is only changed if the whole patch applies.
+	// Fields that JSON doesn't see (unexported or tagged `json:"-"`) keep their value.
+	Apply(target interface{}) error
+}
+
+// MergePatch is a JSON merge patch (RFC 7396).
+type MergePatch json.RawMessage
+
+// JSONPatch is a JSON patch (RFC 6902).
+type JSONPatch []PatchOperation
+
+// PatchOperation is a single operation of a JSONPatch.
+type PatchOperation struct {
+	// Op is one of "add", "remove", "replace", "move", "copy" or "test".
+	Op string `json:"op"`
+	// Path is a JSON pointer (RFC 6901) to the location the operation applies to.
+	Path string `json:"path"`
+	// From is a JSON pointer to the source of "move" and "copy" operations.
+	From string `json:"from,omitempty"`
+	// Value is the value for "add", "replace" and "test" operations.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// PatchError is returned if a patch can't be applied, like when a path doesn't exist or the result doesn't fit in the target.
+type PatchError struct {
+	// Index is the index of the failed operation of a JSONPatch, or -1 if the error isn't about a single operation.
+	Index  int
+	Op     string
+	Path   string
+	Reason string
+}
+
+func (e *PatchError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("cannot apply patch: %s", e.Reason)
+	}
+	return fmt.Sprintf("cannot apply patch operation %d (%s %s): %s", e.Index, e.Op, e.Path, e.Reason)
+}
+
+// PatchTestError is returned if a "test" operation of a JSONPatch fails.
+type PatchTestError struct {
+	Index int
+	Path  string
+}
+
+func (e *PatchTestError) Error() string {
+	return fmt.Sprintf("patch operation %d failed: %s doesn't have the expected value", e.Index, e.Path)
+}
+
+// DecodePatch decodes the request body as a MergePatch or a JSONPatch, depending on its Content-Type.
+func DecodePatch(r *http.Request) (Patch, error) {
+	switch mt := mediaType(r); mt {
+	case mergePatchType:
+		return DecodeMergePatch(r)
+	case jsonPatchType:
+		return DecodeJSONPatch(r)
+	default:
+		return nil, &UnsupportedMediaTypeError{MediaType: mt, Accepted: []string{jsonPatchType, mergePatchType}}
+	}
+}
+
+// DecodeMergePatch decodes the request body, which must be application/merge-patch+json.
+func DecodeMergePatch(r *http.Request) (MergePatch, error) {
+	if mt := mediaType(r); mt != mergePatchType {
+		return nil, &UnsupportedMediaTypeError{MediaType: mt, Accepted: []string{mergePatchType}}
+	}
+	if err := limitBody(r, nil); err != nil {
+		return nil, err
+	}
+	var ret json.RawMessage
+	if err := readJSON(r, &ret, false); err != nil {
+		return nil, err
+	}
+	return MergePatch(ret), nil
+}
+
+// DecodeJSONPatch decodes the request body, which must be application/json-patch+json.
+// The operations are checked for unknown ops, invalid paths and missing values, but not yet applied.
+func DecodeJSONPatch(r *http.Request) (JSONPatch, error) {
+	if mt := mediaType(r); mt != jsonPatchType {
+		return nil, &UnsupportedMediaTypeError{MediaType: mt, Accepted: []string{jsonPatchType}}
+	}
+	if err := limitBody(r, nil); err != nil {
+		return nil, err
+	}
+	var ret JSONPatch
+	if err := readJSON(r, &ret, true); err != nil {
+		return nil, err
+	}
+	var errs DecodeErrors
+	for i, op := range ret {
+		if reason, field := op.check(); reason != "" {
+			errs = append(errs, &DecodeError{Source: "json", Field: fmt.Sprintf("%d.%s", i, field), Reason: reason})
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return ret, nil
+}
+
+// check returns why op is invalid and which of its fields is wrong, or an empty reason if it's valid.
+func (op PatchOperation) check() (reason, field string) {
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return "is required", "value"
+		}
+	case "move", "copy":
+		if _, err := parsePointer(op.From); err != nil {
+			return err.Error(), "from"
+		}
+	case "remove":
+	default:
+		return fmt.Sprintf("unknown operation %q", op.Op), "op"
+	}
+	if _, err := parsePointer(op.Path); err != nil {
+		return err.Error(), "path"
+	}
+	return "", ""
+}
+
+// Apply applies the merge patch to target, which must be a pointer.
+func (p MergePatch) Apply(target interface{}) error {
+	patch, err := unmarshalDoc(p)
+	if err != nil {
+		return &PatchError{Index: -1, Reason: err.Error()}
+	}
+	return patchValue(target, func(doc interface{}) (interface{}, error) {
+		return mergePatch(doc, patch), nil
+	})
+}
+
+func mergePatch(doc, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	d, ok := doc.(map[string]interface{})
+	if !ok {
+		d = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(d, k)
+		} else {
+			d[k] = mergePatch(d[k], v)
+		}
+	}
+	return d
+}
+
+// Apply applies the operations of the JSON patch to target, which must be a pointer. If any operation fails, target is left unchanged.
+func (p JSONPatch) Apply(target interface{}) error {
+	return patchValue(target, func(doc interface{}) (interface{}, error) {
+		for i, op := range p {
+			var err error
+			doc, err = op.apply(doc)
+			if err != nil {
+				if err == errTestFailed {
+					return nil, &PatchTestError{Index: i, Path: op.Path}
+				}
+				return nil, &PatchError{Index: i, Op: op.Op, Path: op.Path, Reason: err.Error()}
+			}
+		}
+		return doc, nil
+	})
+}
+
+var errTestFailed = errors.New("test failed")
+
+func (op PatchOperation) apply(doc interface{}) (interface{}, error) {
+	if reason, field := op.check(); reason != "" {
+		return nil, fmt.Errorf("%s: %s", field, reason)
+	}
+	path, _ := parsePointer(op.Path)
+	var value interface{}
+	if op.Value != nil {
+		var err error
+		if value, err = unmarshalDoc(op.Value); err != nil {
+			return nil, err
+		}
+	}
+	switch op.Op {
+	case "add":
+		return addValue(doc, path, value)
+	case "remove":
+		doc, _, err := removeValue(doc, path)
+		return doc, err
+	case "replace":
+		doc, _, err := removeValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, value)
+	case "move":
+		if op.Path == op.From {
+			return doc, nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("cannot move a value into itself")
+		}
+		from, _ := parsePointer(op.From)
+		doc, v, err := removeValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, v)
+	case "copy":
+		from, _ := parsePointer(op.From)
+		v, err := getValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		// Round trip the value, so the copy doesn't share maps and slices with the original.
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = unmarshalDoc(b); err != nil {
+			return nil, err
+		}
+		return addValue(doc, path, v)
+	default: // "test"
+		v, err := getValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(v, value) {
+			return nil, errTestFailed
+		}
+		return doc, nil
+	}
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("%q is not a JSON pointer", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses the reference token t as an index into an array of length n. If end is set, n and "-" (meaning n) are also accepted.
+func arrayIndex(t string, n int, end bool) (int, error) {
+	if end && t == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(t)
+	if err != nil || i < 0 || (t != "0" && t[0] == '0') {
+		return 0, fmt.Errorf("%q is not an array index", t)
+	}
+	if i > n || (i == n && !end) {
+		return 0, fmt.Errorf("array index %d is out of range", i)
+	}
+	return i, nil
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for _, t := range path {
+		switch c := doc.(type) {
+		case map[string]interface{}:
+			v, ok := c[t]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", t)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(t, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("cannot find %q in a scalar", t)
+		}
+	}
+	return doc, nil
+}
+
+// modify calls f with the container (an object or array) at path[:len(path)-1] and the last reference token of path, and stores the container f returns in its place.
+func modify(doc interface{}, path []string, f func(c interface{}, t string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return f(doc, path[0])
+	}
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		v, ok := c[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", path[0])
+		}
+		v, err := modify(v, path[1:], f)
+		if err != nil {
+			return nil, err
+		}
+		c[path[0]] = v
+		return c, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(c), false)
+		if err != nil {
+			return nil, err
+		}
+		v, err := modify(c[i], path[1:], f)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = v
+		return c, nil
+	default:
+		return nil, fmt.Errorf("cannot find %q in a scalar", path[0])
+	}
+}
+
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return modify(doc, path, func(c interface{}, t string) (interface{}, error) {
+		switch c := c.(type) {
+		case map[string]interface{}:
+			c[t] = value
+			return c, nil
+		case []interface{}:
+			i, err := arrayIndex(t, len(c), true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a scalar", t)
+		}
+	})
+}
+
+// removeValue removes the value at path from doc, and returns the new doc and the removed value.
+func removeValue(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	var removed interface{}
+	doc, err := modify(doc, path, func(c interface{}, t string) (interface{}, error) {
+		switch c := c.(type) {
+		case map[string]interface{}:
+			v, ok := c[t]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", t)
+			}
+			removed = v
+			delete(c, t)
+			return c, nil
+		case []interface{}:
+			i, err := arrayIndex(t, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return append(c[:i], c[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot find %q in a scalar", t)
+		}
+	})
+	return doc, removed, err
+}
+
+// jsonEqual returns whether the decoded JSON values a and b are equal. Numbers are compared by value, so 1 equals 1.0.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		ar, aok := new(big.Rat).SetString(string(a))
+		br, bok := new(big.Rat).SetString(string(b))
+		return aok && bok && ar.Cmp(br) == 0
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if bv, ok := b[k]; !ok || !jsonEqual(v, bv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// unmarshalDoc decodes b into generic JSON values, keeping numbers as json.Number so large integers survive a round trip.
+func unmarshalDoc(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var ret interface{}
+	if err := d.Decode(&ret); err != nil {
+		if err == io.EOF {
+			return nil, errors.New("patch is empty")
+		}
+		return nil, err
+	}
+	return ret, nil
+}
+
+// patchValue converts target to generic JSON values, passes them to f and decodes the result back into target.
+// target is only changed if f succeeds and its result can be decoded into a value of the type of target.
+// Fields JSON doesn't see (unexported or tagged `json:"-"`) keep their value.
+func patchValue(target interface{}, f func(doc interface{}) (interface{}, error)) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("patch target must be a non-nil pointer, not %T", target)
+	}
+	b, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	doc, err := unmarshalDoc(b)
+	if err != nil {
+		return err
+	}
+	if doc, err = f(doc); err != nil {
+		return err
+	}
+	if b, err = json.Marshal(doc); err != nil {
+		return err
+	}
+	nv := reflect.New(v.Elem().Type())
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(nv.Interface()); err != nil {
+		pe := &PatchError{Index: -1, Reason: err.Error()}
+		var ute *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &ute):
+			pe.Path = "/" + strings.ReplaceAll(ute.Field, ".", "/")
+			pe.Reason = fmt.Sprintf("%s: cannot use %s as %s", pe.Path, ute.Value, ute.Type)
+		case isUnknownFieldError(err):
+			field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+			pe.Path = "/" + field
+			pe.Reason = fmt.Sprintf("%s is not a known field", pe.Path)
+		}
+		return pe
+	}
+	ret := reflect.New(v.Elem().Type()).Elem()
+	ret.Set(v.Elem())
+	mergeVisible(ret, nv.Elem())
+	v.Elem().Set(ret)
+	return nil
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// mergeVisible sets the fields of dst that JSON can see to those of src, and leaves the others alone.
+// dst starts out as a shallow copy of the original value, so values it points to are replaced rather than modified.
+func mergeVisible(dst, src reflect.Value) {
+	t := dst.Type()
+	if t.Kind() != reflect.Struct || reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		dst.Set(src)
+		return
+	}
+	for i := 0; t.NumField() > i; i++ {
+		f := t.Field(i)
+		if f.Tag.Get("json") == "-" {
+			continue
+		}
+		if f.PkgPath != "" {
+			// Exported fields of unexported embedded structs are still seen by JSON.
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				mergeVisible(dst.Field(i), src.Field(i))
+			}
+			continue
+		}
+		df, sf := dst.Field(i), src.Field(i)
+		if f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct && !df.IsNil() && !sf.IsNil() {
+			nf := reflect.New(f.Type.Elem())
+			nf.Elem().Set(df.Elem())
+			mergeVisible(nf.Elem(), sf.Elem())
+			df.Set(nf)
+			continue
+		}
+		mergeVisible(df, sf)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteURL builds the URL of route, like mux.Route.URL. The variables of the route are taken from values, which must have exactly one value for each of them.
+// The other values are added to the query string.
+func RouteURL(route *mux.Route, values url.Values) (*url.URL, error) {
+	vars, _ := routeVars(route)
+	pairs := make([]string, 0, len(vars)*2)
+	rest := url.Values{}
+	for k, v := range values {
+		rest[k] = v
+	}
+	for _, name := range vars {
+		switch len(values[name]) {
+		case 0:
+			return nil, fmt.Errorf("field %q required for the route is missing", name)
+		case 1:
+			pairs = append(pairs, name, values[name][0])
+			delete(rest, name)
+		default:
+			return nil, fmt.Errorf("multiple values for field %q encountered", name)
+		}
+	}
+	u, err := route.URL(pairs...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		if u.RawQuery == "" {
+			u.RawQuery = rest.Encode()
+		} else {
+			u.RawQuery += "&" + rest.Encode()
+		}
+	}
+	return u, nil
+}
+
+// routeVars returns the names of the variables in the host, path and query templates of route, and the query parameters its query templates produce.
+func routeVars(route *mux.Route) (vars, queryKeys []string) {
+	var templates []string
+	if t, err := route.GetHostTemplate(); err == nil {
+		templates = append(templates, t)
+	}
+	if t, err := route.GetPathTemplate(); err == nil {
+		templates = append(templates, t)
+	}
+	queries, _ := route.GetQueriesTemplates()
+	for _, q := range queries {
+		key, _, _ := strings.Cut(q, "=")
+		queryKeys = append(queryKeys, key)
+	}
+	for _, t := range append(templates, queries...) {
+		vars = append(vars, templateVars(t)...)
+	}
+	return vars, queryKeys
+}
+
+// templateVars returns the names of the variables in a mux template, like "category" and "id" for "/{category}/{id:[0-9]{1,5}}".
+func templateVars(tpl string) []string {
+	var ret []string
+	level, start := 0, 0
+	for i := 0; len(tpl) > i; i++ {
+		switch tpl[i] {
+		case '{':
+			if level == 0 {
+				start = i + 1
+			}
+			level++
+		case '}':
+			level--
+			if level == 0 {
+				name, _, _ := strings.Cut(tpl[start:i], ":")
+				ret = append(ret, strings.TrimSpace(name))
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/schema"
+)
+
+// StrictDecodingContextKey is used to store in the context whether unknown fields in the input should be rejected.
+var StrictDecodingContextKey ctxKey = 5
+
+// StrictDecoder can be implemented by input types to override whether unknown fields are rejected when decoding into them.
+type StrictDecoder interface {
+	StrictDecoding() bool
+}
+
+// isStrict returns whether unknown fields should be rejected when decoding into ret. ret may be nil.
+func isStrict(r *http.Request, ret interface{}) bool {
+	if sd, ok := ret.(StrictDecoder); ok {
+		return sd.StrictDecoding()
+	}
+	strict, _ := r.Context().Value(StrictDecodingContextKey).(bool)
+	return strict
+}
+
+// allowKeys removes errors about the given unknown keys from an error returned by gorilla/schema. It returns nil if no errors remain.
+func allowKeys(err error, keys map[string]string) error {
+	var me schema.MultiError
+	if len(keys) == 0 || !errors.As(err, &me) {
+		return err
+	}
+	ret := schema.MultiError{}
+	for k, e := range me {
+		var uke schema.UnknownKeyError
+		if errors.As(e, &uke) {
+			if _, ok := keys[uke.Key]; ok {
+				continue
+			}
+		}
+		ret[k] = e
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// sources are the struct tags that say where a field of a tagged input struct comes from, in the order they're decoded.
+var sources = []string{"path", "query", "header", "cookie", "form"}
+
+// taggedSource describes how to decode the fields of a tagged input struct that come from one source.
+// The fields are decoded into a generated struct type with the same field types, which gives us gorilla/schema's conversions and `required` checks.
+type taggedSource struct {
+	name string
+	typ  reflect.Type
+	// fields are the indexes of the fields in the input struct. typ.Field(i) is copied to fields[i].
+	fields [][]int
+	// keys are the names of the values to read from the source.
+	keys []string
+}
+
+type taggedStruct struct {
+	sources []taggedSource
+	// body is the index of the field tagged with `body`, or nil.
+	body []int
+}
+
+var taggedStructs sync.Map // map[typeAndTag]*taggedStruct
+
+// IsTagged returns whether t is a struct of which at least one field is tagged with its source (`path`, `query`, `header`, `cookie`, `form` or `body`).
+func IsTagged(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; t.NumField() > i; i++ {
+		if _, ok := t.Field(i).Tag.Lookup("body"); ok {
+			return true
+		}
+		for _, src := range sources {
+			if _, ok := t.Field(i).Tag.Lookup(src); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckTagged returns an error if the tagged input struct t can't be decoded by DecodeTagged.
+func CheckTagged(t reflect.Type) error {
+	_, err := getTaggedStruct(t, "schema")
+	return err
+}
+
+// getTaggedStruct returns how to decode t. The generated structs use aliasTag for the names of the fields.
+func getTaggedStruct(t reflect.Type, aliasTag string) (*taggedStruct, error) {
+	key := typeAndTag{t, aliasTag}
+	if ts, ok := taggedStructs.Load(key); ok {
+		return ts.(*taggedStruct), nil
+	}
+	ts, err := newTaggedStruct(t, aliasTag)
+	if err != nil {
+		return nil, err
+	}
+	taggedStructs.Store(key, ts)
+	return ts, nil
+}
+
+func newTaggedStruct(t reflect.Type, aliasTag string) (*taggedStruct, error) {
+	ret := &taggedStruct{}
+	bySource := map[string]*taggedSource{}
+	var fields map[string][]reflect.StructField
+	for i := 0; t.NumField() > i; i++ {
+		f := t.Field(i)
+		if _, ok := f.Tag.Lookup("body"); ok {
+			if ret.body != nil {
+				return nil, fmt.Errorf("%s has multiple fields tagged with `body`", t)
+			}
+			ret.body = f.Index
+			continue
+		}
+		for _, src := range sources {
+			tag, ok := f.Tag.Lookup(src)
+			if !ok {
+				continue
+			}
+			if f.PkgPath != "" {
+				return nil, fmt.Errorf("%s.%s is tagged with `%s`, but isn't exported", t, f.Name, src)
+			}
+			name := strings.Split(tag, ",")[0]
+			if name == "" {
+				name = f.Name
+			}
+			ts, ok := bySource[src]
+			if !ok {
+				ts = &taggedSource{name: src}
+				bySource[src] = ts
+			}
+			if fields == nil {
+				fields = map[string][]reflect.StructField{}
+			}
+			st := fmt.Sprintf("%s:%q", aliasTag, tag)
+			if def, ok := f.Tag.Lookup("default"); ok {
+				st += fmt.Sprintf(" default:%q", def)
+			}
+			fields[src] = append(fields[src], reflect.StructField{
+				Name: fmt.Sprintf("F%d", len(ts.fields)),
+				Type: f.Type,
+				Tag:  reflect.StructTag(st),
+			})
+			ts.fields = append(ts.fields, f.Index)
+			ts.keys = append(ts.keys, name)
+			break
+		}
+	}
+	for _, src := range sources {
+		if ts, ok := bySource[src]; ok {
+			ts.typ = reflect.StructOf(fields[src])
+			ret.sources = append(ret.sources, *ts)
+		}
+	}
+	return ret, nil
+}
+
+// values returns the values for this source from the request.
+func (ts *taggedSource) values(r *http.Request) (url.Values, error) {
+	switch ts.name {
+	case "path":
+		vm := url.Values{}
+		for k, v := range mux.Vars(r) {
+			vm.Set(k, v)
+		}
+		return vm, nil
+	case "query":
+		return url.ParseQuery(r.URL.RawQuery)
+	case "header":
+		vm := url.Values{}
+		for _, k := range ts.keys {
+			if v := r.Header.Values(k); len(v) > 0 {
+				vm[k] = v
+			}
+		}
+		return vm, nil
+	case "cookie":
+		vm := url.Values{}
+		for _, c := range r.Cookies() {
+			vm[c.Name] = append(vm[c.Name], c.Value)
+		}
+		return vm, nil
+	case "form":
+		if err := parseForm(r); err != nil {
+			return nil, err
+		}
+		return r.PostForm, nil
+	}
+	panic(fmt.Errorf("unknown source %q", ts.name))
+}
+
+// DecodeTagged decodes a struct of which the fields are tagged with where they come from, like `query:"q"` or `header:"X-Tenant"`.
+// Each source uses github.com/gorilla/schema for conversion, so tag options like `required` work as usual.
+// The field tagged with `body` is decoded from the request body as JSON.
+func DecodeTagged(r *http.Request, ret interface{}) error {
+	v := reflect.ValueOf(ret).Elem()
+	d := decoderFrom(r)
+	ts, err := getTaggedStruct(v.Type(), d.aliasTag)
+	if err != nil {
+		return err
+	}
+	if err := limitBody(r, ret); err != nil {
+		return err
+	}
+	strict := isStrict(r, ret)
+	if df, ok := ret.(Defaulter); ok {
+		df.Defaults()
+	}
+	for _, src := range ts.sources {
+		vm, err := src.values(r)
+		if err != nil {
+			return bodyError(src.name, err)
+		}
+		tmp := reflect.New(src.typ).Elem()
+		// Start from the current values, so those set by Defaults are kept.
+		for i, idx := range src.fields {
+			tmp.Field(i).Set(v.FieldByIndex(idx))
+		}
+		// Only the query and form are checked for unknown keys, as requests have many headers and cookies that aren't meant for us.
+		if err := d.decode(tmp.Addr().Interface(), vm, strict && (src.name == "query" || src.name == "form")); err != nil {
+			return d.unauthorized(src.typ, schemaErrors(err, vm, sourceIs(src.name)))
+		}
+		for i, idx := range src.fields {
+			v.FieldByIndex(idx).Set(tmp.Field(i))
+		}
+	}
+	if ts.body != nil {
+		if err := decodeJSON(r, v.FieldByIndex(ts.body).Addr().Interface(), strict); err != nil {
+			return err
+		}
+	}
+	return nil
+}
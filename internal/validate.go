@@ -0,0 +1,375 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldErrorHandlerContextKey is used to store a FieldErrorHandler in the context.
+var FieldErrorHandlerContextKey ctxKey = 9
+
+// FieldErrorHandler is a callback type that you can register with ContextWithFieldErrorHandler or WithFieldErrorHandler to render errors about specific input fields, like failed validation.
+type FieldErrorHandler func(code int, msg string, fields FieldErrors, r *http.Request) HttpResponse
+
+// FieldError describes why the value of a single input field was rejected.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// Error implements error.
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Reason
+	}
+	return e.Field + ": " + e.Reason
+}
+
+// FieldErrors is a list of problems with input fields. It can be returned from Validate() methods to report problems with multiple fields.
+type FieldErrors []FieldError
+
+// Error implements error.
+func (e FieldErrors) Error() string {
+	s := make([]string, len(e))
+	for i, fe := range e {
+		s[i] = fe.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// nameTags are the struct tags that are looked at to find the name of a field as the client knows it.
+var nameTags = []string{"schema", "json", "path", "query", "header", "cookie", "form"}
+
+type rule func(v reflect.Value) (reason string)
+
+type fieldRules struct {
+	index    []int
+	name     string
+	required bool
+	// omitEmpty skips the other rules for zero values.
+	omitEmpty bool
+	rules     []rule
+	// nested is set for struct fields (or pointers to structs) that have rules themselves.
+	nested *structRules
+}
+
+type structRules struct {
+	fields []fieldRules
+}
+
+type cachedRules struct {
+	sr  *structRules
+	err error
+}
+
+var validationCache sync.Map // map[reflect.Type]cachedRules
+
+// CheckValidation returns an error if the `validate` tags in t (or the type t points to) are invalid.
+func CheckValidation(t reflect.Type) error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	_, err := getStructRules(t)
+	return err
+}
+
+// Validate checks the struct v points to (possibly through multiple pointers) against its `validate` struct tags.
+// If those pass and v has a method `Validate() error`, it is called too.
+// It returns nil if v is valid.
+//
+// Supported rules are required, omitempty, min=N, max=N, len=N, oneof=a b c, email, url and regexp=pattern. regexp must be the last rule, as the pattern may contain commas.
+// Rules apply to zero values too, so min=1 rejects 0 and oneof=a b rejects "". omitempty skips the other rules for zero values, which makes a field optional.
+// Nil pointers are always skipped unless the field is required, so a pointer field can tell a field that wasn't sent apart from an explicit zero value.
+// For numbers min and max compare the value, for strings, slices and maps they compare the length.
+func Validate(v interface{}) FieldErrors {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		rv = rv.Elem()
+		v = rv.Interface()
+	}
+	var errs FieldErrors
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Struct {
+		sr, err := getStructRules(rv.Elem().Type())
+		if err != nil {
+			return FieldErrors{{Reason: err.Error()}}
+		}
+		errs = sr.validate(rv.Elem(), "", errs)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	if vr, ok := v.(interface{ Validate() error }); ok {
+		if err := vr.Validate(); err != nil {
+			var fes FieldErrors
+			var fe FieldError
+			if errors.As(err, &fes) {
+				return fes
+			}
+			if errors.As(err, &fe) {
+				return FieldErrors{fe}
+			}
+			return FieldErrors{{Reason: err.Error()}}
+		}
+	}
+	return nil
+}
+
+func (sr *structRules) validate(v reflect.Value, prefix string, errs FieldErrors) FieldErrors {
+	for _, fr := range sr.fields {
+		fv := v.FieldByIndex(fr.index)
+		if fv.IsZero() {
+			if fr.required {
+				errs = append(errs, FieldError{prefix + fr.name, "is required"})
+				continue
+			}
+			if fr.omitEmpty || fv.Kind() == reflect.Ptr {
+				continue
+			}
+		}
+		if fv.Kind() == reflect.Ptr {
+			fv = fv.Elem()
+		}
+		for _, r := range fr.rules {
+			if reason := r(fv); reason != "" {
+				errs = append(errs, FieldError{prefix + fr.name, reason})
+			}
+		}
+		if fr.nested != nil {
+			errs = fr.nested.validate(fv, prefix+fr.name+".", errs)
+		}
+	}
+	return errs
+}
+
+func getStructRules(t reflect.Type) (*structRules, error) {
+	if c, ok := validationCache.Load(t); ok {
+		return c.(cachedRules).sr, c.(cachedRules).err
+	}
+	sr, err := newStructRules(t, map[reflect.Type]bool{})
+	validationCache.Store(t, cachedRules{sr, err})
+	return sr, err
+}
+
+func newStructRules(t reflect.Type, seen map[reflect.Type]bool) (*structRules, error) {
+	if seen[t] {
+		// Recursive types only get validated until the recursion.
+		return nil, nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+	sr := &structRules{}
+	for i := 0; t.NumField() > i; i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		fr := fieldRules{
+			index: f.Index,
+			name:  fieldName(f),
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if tag, ok := f.Tag.Lookup("validate"); ok {
+			if err := fr.parse(ft, tag); err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", t, f.Name, err)
+			}
+		}
+		if ft.Kind() == reflect.Struct {
+			nested, err := newStructRules(ft, seen)
+			if err != nil {
+				return nil, err
+			}
+			if nested != nil && len(nested.fields) > 0 {
+				fr.nested = nested
+			}
+		}
+		if fr.required || len(fr.rules) > 0 || fr.nested != nil {
+			sr.fields = append(sr.fields, fr)
+		}
+	}
+	return sr, nil
+}
+
+// fieldName returns the name of the field as the client knows it.
+func fieldName(f reflect.StructField) string {
+	for _, tag := range nameTags {
+		if name := strings.Split(f.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+func (fr *fieldRules) parse(t reflect.Type, tag string) error {
+	for tag != "" {
+		var r string
+		if strings.HasPrefix(tag, "regexp=") {
+			r, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			r, tag = tag[:i], tag[i+1:]
+		} else {
+			r, tag = tag, ""
+		}
+		name, arg := r, ""
+		if i := strings.Index(r, "="); i >= 0 {
+			name, arg = r[:i], r[i+1:]
+		}
+		switch name {
+		case "required":
+			fr.required = true
+		case "omitempty":
+			fr.omitEmpty = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Errorf("invalid argument for %s: %q", name, arg)
+			}
+			rl, err := boundRule(t, name == "min", n)
+			if err != nil {
+				return err
+			}
+			fr.rules = append(fr.rules, rl)
+		case "len":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid argument for len: %q", arg)
+			}
+			if !hasLength(t) {
+				return fmt.Errorf("len can't be used on %s", t)
+			}
+			fr.rules = append(fr.rules, func(v reflect.Value) string {
+				if length(v) != n {
+					return fmt.Sprintf("must have length %d", n)
+				}
+				return ""
+			})
+		case "oneof":
+			if t.Kind() != reflect.String {
+				return fmt.Errorf("oneof can't be used on %s", t)
+			}
+			options := strings.Fields(arg)
+			fr.rules = append(fr.rules, func(v reflect.Value) string {
+				for _, o := range options {
+					if v.String() == o {
+						return ""
+					}
+				}
+				return fmt.Sprintf("must be one of %s", strings.Join(options, ", "))
+			})
+		case "email":
+			if t.Kind() != reflect.String {
+				return fmt.Errorf("email can't be used on %s", t)
+			}
+			fr.rules = append(fr.rules, func(v reflect.Value) string {
+				if a, err := mail.ParseAddress(v.String()); err != nil || a.Address != v.String() {
+					return "must be an email address"
+				}
+				return ""
+			})
+		case "url":
+			if t.Kind() != reflect.String {
+				return fmt.Errorf("url can't be used on %s", t)
+			}
+			fr.rules = append(fr.rules, func(v reflect.Value) string {
+				if u, err := url.ParseRequestURI(v.String()); err != nil || u.Scheme == "" || u.Host == "" {
+					return "must be a URL"
+				}
+				return ""
+			})
+		case "regexp":
+			if t.Kind() != reflect.String {
+				return fmt.Errorf("regexp can't be used on %s", t)
+			}
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return err
+			}
+			fr.rules = append(fr.rules, func(v reflect.Value) string {
+				if !re.MatchString(v.String()) {
+					return fmt.Sprintf("must match %s", re)
+				}
+				return ""
+			})
+		default:
+			return fmt.Errorf("unknown validation rule %q", name)
+		}
+	}
+	return nil
+}
+
+func hasLength(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return true
+	}
+	return false
+}
+
+func length(v reflect.Value) int {
+	if v.Kind() == reflect.String {
+		return utf8.RuneCountInString(v.String())
+	}
+	return v.Len()
+}
+
+// boundRule returns a rule for min (if isMin) or max.
+func boundRule(t reflect.Type, isMin bool, n float64) (rule, error) {
+	var get func(v reflect.Value) float64
+	what := "be"
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		get = func(v reflect.Value) float64 { return float64(v.Int()) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		get = func(v reflect.Value) float64 { return float64(v.Uint()) }
+	case reflect.Float32, reflect.Float64:
+		get = func(v reflect.Value) float64 { return v.Float() }
+	default:
+		if !hasLength(t) {
+			return nil, fmt.Errorf("min and max can't be used on %s", t)
+		}
+		get = func(v reflect.Value) float64 { return float64(length(v)) }
+		what = "have length"
+	}
+	if isMin {
+		return func(v reflect.Value) string {
+			if get(v) < n {
+				return fmt.Sprintf("must %s at least %v", what, n)
+			}
+			return ""
+		}, nil
+	}
+	return func(v reflect.Value) string {
+		if get(v) > n {
+			return fmt.Sprintf("must %s at most %v", what, n)
+		}
+		return ""
+	}, nil
+}
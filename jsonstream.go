@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/Jille/convreq/internal"
+)
+
+// RecordError is returned by JSONStream.Record for a record that couldn't be decoded or isn't valid. Err is DecodeErrors or FieldErrors.
+type RecordError = internal.RecordError
+
+// RecordTooLargeError is returned by JSONStream.Err if a record is larger than the maximum record size.
+type RecordTooLargeError = internal.RecordTooLargeError
+
+// DefaultMaxRecordSize is the maximum size of a single record in a JSONStream, unless changed with SetMaxRecordSize.
+const DefaultMaxRecordSize = internal.DefaultMaxRecordSize
+
+// JSONStream can be taken as a parameter by request handlers to read records of type T one by one from a request body that is either a JSON array or newline delimited JSON (application/x-ndjson).
+// Records are decoded as they are read, so the body isn't buffered in memory. The body is still limited to the MaxBodySize (see WithMaxBodySize).
+//
+//	for s.Next() {
+//		rec, err := s.Record()
+//		...
+//	}
+//	if err := s.Err(); err != nil {
+//		return convreq.DecodeFailed(err)
+//	}
+type JSONStream[T any] struct {
+	recs   *internal.JSONRecords
+	rec    T
+	recErr error
+}
+
+// NewJSONStream returns a JSONStream for the request body. Errors can be passed to DecodeFailed.
+func NewJSONStream[T any](r *http.Request) (*JSONStream[T], error) {
+	s := &JSONStream[T]{}
+	if err := s.init(r); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// jsonStream is implemented by all JSONStreams, so Wrap can recognize them.
+type jsonStream interface {
+	init(r *http.Request) error
+}
+
+var jsonStreamType = reflect.TypeOf((*jsonStream)(nil)).Elem()
+
+func (s *JSONStream[T]) init(r *http.Request) error {
+	recs, err := internal.NewJSONRecords(r, &s.rec)
+	if err != nil {
+		return err
+	}
+	s.recs = recs
+	return nil
+}
+
+// SetMaxRecordSize changes the maximum size of a single record. Zero means unlimited. The default is DefaultMaxRecordSize.
+func (s *JSONStream[T]) SetMaxRecordSize(n int64) {
+	s.recs.SetMaxRecordSize(n)
+}
+
+// Next reads the next record, which is then returned by Record.
+// It returns false when there are no more records, or when the stream can't be read any further (like when the request is canceled), in which case Err returns why.
+func (s *JSONStream[T]) Next() bool {
+	var zero T
+	s.rec = zero
+	ok, err := s.recs.Next(&s.rec)
+	s.recErr = err
+	return ok
+}
+
+// Record returns the record read by Next. The error is a *RecordError if this record couldn't be decoded or isn't valid; the following records can still be read.
+func (s *JSONStream[T]) Record() (T, error) {
+	return s.rec, s.recErr
+}
+
+// Err returns the error that stopped the stream, or nil if all records were read.
+func (s *JSONStream[T]) Err() error {
+	return s.recs.Err()
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+type importRecord struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func (r importRecord) Validate() error {
+	if r.Count < 0 {
+		return convreq.FieldErrors{{Field: "count", Reason: "must not be negative"}}
+	}
+	return nil
+}
+
+// importRecords writes one line per record (or record error) to the response.
+func importRecords(s *convreq.JSONStream[importRecord]) convreq.HttpResponse {
+	s.SetMaxRecordSize(64)
+	var sb strings.Builder
+	for s.Next() {
+		rec, err := s.Record()
+		if err != nil {
+			fmt.Fprintf(&sb, "%v\n", err)
+			continue
+		}
+		fmt.Fprintf(&sb, "%s=%d\n", rec.Name, rec.Count)
+	}
+	if err := s.Err(); err != nil {
+		return convreq.DecodeFailed(err)
+	}
+	return respond.String(sb.String())
+}
+
+func TestJSONStream(t *testing.T) {
+	handler := convreq.Wrap(importRecords)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		ctx         context.Context
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:        "array",
+			contentType: "application/json",
+			body:        `[{"name": "a", "count": 1}, {"name": "b", "count": 2}]`,
+			wantCode:    200,
+			wantBody:    "a=1\nb=2\n",
+		},
+		{
+			name:        "empty array",
+			contentType: "application/json",
+			body:        `[]`,
+			wantCode:    200,
+		},
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			body:        "{\"name\": \"a\", \"count\": 1}\n{\"name\": \"b\", \"count\": 2}\n",
+			wantCode:    200,
+			wantBody:    "a=1\nb=2\n",
+		},
+		{
+			name:        "record errors",
+			contentType: "application/x-ndjson",
+			body:        "{\"name\": \"a\", \"count\": \"x\"}\n{\"name\": \"b\", \"count\": -1}\n{\"name\": \"c\", \"count\": 3}\n",
+			wantCode:    200,
+			wantBody:    "record 0: failed to parse json: count: cannot use string as int\nrecord 1: count: must not be negative\nc=3\n",
+		},
+		{
+			name:        "syntax error",
+			contentType: "application/json",
+			body:        `[{"name": "a", "count": 1}, {"name": `,
+			wantCode:    400,
+			wantBody:    "failed to parse json: unexpected EOF\n",
+		},
+		{
+			name:        "not an array",
+			contentType: "application/json",
+			body:        `{"name": "a"}`,
+			wantCode:    400,
+			wantBody:    "failed to parse json: expected an array, got {\n",
+		},
+		{
+			name:        "record too large",
+			contentType: "application/x-ndjson",
+			body:        `{"name": "` + strings.Repeat("a", 100) + `"}`,
+			wantCode:    413,
+			wantBody:    "record 0 is larger than 64 bytes\n",
+		},
+		{
+			name:        "wrong content type",
+			contentType: "text/plain",
+			body:        `[]`,
+			wantCode:    415,
+			wantBody:    "expected Content-Type: application/json, application/x-ndjson rather than \"text/plain\"\n",
+		},
+		{
+			name:        "canceled",
+			contentType: "application/json",
+			body:        `[{"name": "a", "count": 1}]`,
+			ctx:         canceled,
+			wantCode:    400,
+			wantBody:    "context canceled\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			if tc.ctx != nil {
+				req = req.WithContext(tc.ctx)
+			}
+			req.Header.Set("Content-Type", tc.contentType)
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
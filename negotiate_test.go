@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"html/template"
+	"net/http/httptest"
+	"testing"
+	texttemplate "text/template"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+type article struct {
+	Title string `json:"title" xml:"title"`
+}
+
+func TestNegotiate(t *testing.T) {
+	opts := respond.NegotiateOptions{
+		HTML: template.Must(template.New("html").Parse("<h1>{{.Title}}</h1>")),
+		Text: texttemplate.Must(texttemplate.New("text").Parse("{{.Title}}")),
+		XML:  true,
+	}
+	handler := convreq.Wrap(func() convreq.HttpResponse {
+		return respond.Negotiate(article{Title: "Fish & chips"}, opts)
+	})
+	jsonOnly := convreq.Wrap(func() convreq.HttpResponse {
+		return respond.Negotiate(article{Title: "Fish & chips"}, respond.NegotiateOptions{})
+	})
+	tests := []struct {
+		name            string
+		accept          string
+		jsonOnly        bool
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "no Accept",
+			wantCode:        200,
+			wantContentType: "application/json",
+			wantBody:        `{"title":"Fish \u0026 chips"}` + "\n",
+		},
+		{
+			name:            "browser",
+			accept:          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			wantCode:        200,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "<h1>Fish &amp; chips</h1>",
+		},
+		{
+			name:            "q-values",
+			accept:          "application/json;q=0.5, application/xml",
+			wantCode:        200,
+			wantContentType: "application/xml; charset=utf-8",
+			wantBody:        `<?xml version="1.0" encoding="UTF-8"?>` + "\n<article><title>Fish &amp; chips</title></article>",
+		},
+		{
+			name:            "wildcard subtype",
+			accept:          "text/*;q=0.5, text/html;q=0",
+			wantCode:        200,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "Fish & chips",
+		},
+		{
+			name:     "nothing acceptable",
+			accept:   "image/png",
+			wantCode: 406,
+			wantBody: "none of the accepted media types is available; supported are application/json, text/html, application/xml, text/plain\n",
+		},
+		{
+			name:     "HTML not offered",
+			accept:   "text/html",
+			jsonOnly: true,
+			wantCode: 406,
+			wantBody: "none of the accepted media types is available; supported are application/json\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			respRecorder := httptest.NewRecorder()
+			if tc.jsonOnly {
+				jsonOnly.ServeHTTP(respRecorder, req)
+			} else {
+				handler.ServeHTTP(respRecorder, req)
+			}
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("got Vary %q; want %q", got, "Accept")
+			}
+			if tc.wantContentType != "" {
+				if got := respRecorder.Header().Get("Content-Type"); got != tc.wantContentType {
+					t.Errorf("got Content-Type %q; want %q", got, tc.wantContentType)
+				}
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+	"github.com/gorilla/mux"
+)
+
+func TestPage(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+	opts := convreq.WithPageOptions(convreq.PageOptions{DefaultLimit: 2, MaxLimit: 3, CursorKey: []byte("secret")})
+	router := mux.NewRouter()
+	router.Handle("/orgs/{org}/offset", convreq.Wrap(func(p convreq.Page) convreq.HttpResponse {
+		end := p.Offset + p.Limit
+		if end >= len(items) {
+			return respond.Paginated(items[p.Offset:], nil)
+		}
+		return respond.Paginated(items[p.Offset:end], p.Next())
+	}, opts))
+	// Only MaxLimit is set, so the default limit of 50 is capped to it.
+	router.Handle("/orgs/{org}/partial", convreq.Wrap(func(p convreq.Page) convreq.HttpResponse {
+		return respond.Paginated(items[p.Offset:p.Offset+p.Limit], p.Next())
+	}, convreq.WithPageOptions(convreq.PageOptions{MaxLimit: 1})))
+	cursorHandler := func(p convreq.Page) convreq.HttpResponse {
+		// The cursor is the last item of the previous page.
+		start := 0
+		if p.Cursor != "" {
+			start = strings.Index(strings.Join(items, ""), p.Cursor) + 1
+		}
+		end := start + p.Limit
+		if end >= len(items) {
+			return respond.Paginated(items[start:], nil)
+		}
+		return respond.Paginated(items[start:end], p.NextCursor(items[end-1]))
+	}
+	router.Handle("/orgs/{org}/cursor", convreq.Wrap(cursorHandler, opts))
+	router.Handle("/orgs/{org}/nokey", convreq.Wrap(cursorHandler))
+	tests := []struct {
+		name     string
+		url      string
+		wantCode int
+		wantBody string
+		wantLink string
+	}{
+		{
+			name:     "first page",
+			url:      "/orgs/acme/offset?q=x",
+			wantCode: 200,
+			wantBody: `["a","b"]` + "\n",
+			wantLink: `</orgs/acme/offset?q=x&limit=2&offset=2>; rel="next"`,
+		},
+		{
+			name:     "middle page",
+			url:      "/orgs/acme/offset?limit=2&offset=1",
+			wantCode: 200,
+			wantBody: `["b","c"]` + "\n",
+			wantLink: `</orgs/acme/offset?limit=2&offset=3>; rel="next", </orgs/acme/offset?limit=2>; rel="prev"`,
+		},
+		{
+			name:     "last page",
+			url:      "/orgs/acme/offset?limit=3&offset=3",
+			wantCode: 200,
+			wantBody: `["d","e"]` + "\n",
+			wantLink: `</orgs/acme/offset?limit=3>; rel="prev"`,
+		},
+		{
+			name:     "query order is kept",
+			url:      "/orgs/acme/offset?z=1&limit=2&a=%C3%A9&offset=2",
+			wantCode: 200,
+			wantBody: `["c","d"]` + "\n",
+			wantLink: `</orgs/acme/offset?z=1&a=%C3%A9&limit=2&offset=4>; rel="next", </orgs/acme/offset?z=1&a=%C3%A9&limit=2>; rel="prev"`,
+		},
+		{
+			name:     "limit is capped",
+			url:      "/orgs/acme/offset?limit=1000",
+			wantCode: 200,
+			wantBody: `["a","b","c"]` + "\n",
+			wantLink: `</orgs/acme/offset?limit=3&offset=3>; rel="next"`,
+		},
+		{
+			name:     "partial options",
+			url:      "/orgs/acme/partial?offset=1",
+			wantCode: 200,
+			wantBody: `["b"]` + "\n",
+			wantLink: `</orgs/acme/partial?limit=1&offset=2>; rel="next", </orgs/acme/partial?limit=1>; rel="prev"`,
+		},
+		{
+			name:     "bad limit",
+			url:      "/orgs/acme/offset?limit=0&offset=-1",
+			wantCode: 400,
+			wantBody: "failed to parse query: limit: must be at least 1; failed to parse query: offset: must not be negative\n",
+		},
+		{
+			name:     "first cursor page",
+			url:      "/orgs/acme/cursor",
+			wantCode: 200,
+			wantBody: `["a","b"]` + "\n",
+			wantLink: `</orgs/acme/cursor?cursor=Yg.jK8pWDfgnIdsDF73KVgdXnXvk63BBCDOcaqwVjasY-0&limit=2>; rel="next"`,
+		},
+		{
+			name:     "next cursor page",
+			url:      "/orgs/acme/cursor?cursor=Yg.jK8pWDfgnIdsDF73KVgdXnXvk63BBCDOcaqwVjasY-0&limit=2",
+			wantCode: 200,
+			wantBody: `["c","d"]` + "\n",
+			wantLink: `</orgs/acme/cursor?cursor=ZA.3td3DMvhMpO6ffwJ8blq_9pDf6w5XrFYbfHkZAzKF5U&limit=2>; rel="next"`,
+		},
+		{
+			name:     "forged cursor",
+			url:      "/orgs/acme/cursor?cursor=Yw.91TN3hlDvjhX1fYVNhCtgJDmVydzUfzPdfVcYXvcczk",
+			wantCode: 400,
+			wantBody: "failed to parse query: cursor: is invalid\n",
+		},
+		{
+			name:     "cursor page without key",
+			url:      "/orgs/acme/nokey?limit=2",
+			wantCode: 500,
+			wantBody: "can't sign a page cursor without PageOptions.CursorKey\n",
+		},
+		{
+			name:     "cursor without key",
+			url:      "/orgs/acme/nokey?cursor=Yg.jK8pWDfgnIdsDF73KVgdXnXvk63BBCDOcaqwVjasY-0",
+			wantCode: 400,
+			wantBody: "failed to parse query: cursor: is invalid\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			router.ServeHTTP(respRecorder, httptest.NewRequest("GET", tc.url, nil))
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+			if got := respRecorder.Header().Get("Link"); got != tc.wantLink {
+				t.Errorf("got Link %q; want %q", got, tc.wantLink)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+type patchedItem struct {
+	Name  string            `json:"name"`
+	Count int64             `json:"count"`
+	Tags  []string          `json:"tags"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+func patchItem(p convreq.Patch) convreq.HttpResponse {
+	item := patchedItem{Name: "dude", Count: 9007199254740993, Tags: []string{"a", "b"}}
+	if err := p.Apply(&item); err != nil {
+		return convreq.DecodeFailed(err)
+	}
+	return respond.JSON(item)
+}
+
+func TestPatch(t *testing.T) {
+	handler := convreq.Wrap(patchItem)
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:        "merge patch",
+			contentType: "application/merge-patch+json",
+			body:        `{"name": "sweet", "tags": null, "attrs": {"color": "red"}}`,
+			wantCode:    200,
+			wantBody:    `{"name":"sweet","count":9007199254740993,"tags":null,"attrs":{"color":"red"}}` + "\n",
+		},
+		{
+			name:        "merge patch with unknown field",
+			contentType: "application/merge-patch+json",
+			body:        `{"nmae": "sweet"}`,
+			wantCode:    422,
+			wantBody:    "cannot apply patch: /nmae is not a known field\n",
+		},
+		{
+			name:        "merge patch with wrong type",
+			contentType: "application/merge-patch+json",
+			body:        `{"count": "many"}`,
+			wantCode:    422,
+			wantBody:    "cannot apply patch: /count: cannot use string as int64\n",
+		},
+		{
+			name:        "json patch",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/name", "value": "dude"}, {"op": "replace", "path": "/name", "value": "sweet"}, {"op": "add", "path": "/tags/1", "value": "c"}, {"op": "remove", "path": "/tags/0"}, {"op": "copy", "from": "/tags/1", "path": "/tags/-"}]`,
+			wantCode:    200,
+			wantBody:    `{"name":"sweet","count":9007199254740993,"tags":["c","b","b"]}` + "\n",
+		},
+		{
+			name:        "json patch move",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "add", "path": "/attrs", "value": {}}, {"op": "move", "from": "/name", "path": "/attrs/old~1name"}, {"op": "add", "path": "/name", "value": "sweet"}]`,
+			wantCode:    200,
+			wantBody:    `{"name":"sweet","count":9007199254740993,"tags":["a","b"],"attrs":{"old/name":"dude"}}` + "\n",
+		},
+		{
+			name:        "json patch with null value",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "replace", "path": "/tags", "value": null}]`,
+			wantCode:    200,
+			wantBody:    `{"name":"dude","count":9007199254740993,"tags":null}` + "\n",
+		},
+		{
+			name:        "failed test",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/count", "value": 1}, {"op": "replace", "path": "/name", "value": "sweet"}]`,
+			wantCode:    409,
+			wantBody:    "patch operation 0 failed: /count doesn't have the expected value\n",
+		},
+		{
+			name:        "missing path",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "replace", "path": "/name", "value": "sweet"}, {"op": "remove", "path": "/tags/5"}]`,
+			wantCode:    422,
+			wantBody:    "cannot apply patch operation 1 (remove /tags/5): array index 5 is out of range\n",
+		},
+		{
+			name:        "invalid operation",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "replace", "path": "/name"}, {"op": "frobnicate", "path": "/name"}]`,
+			wantCode:    400,
+			wantBody:    "failed to parse json: 0.value: is required; failed to parse json: 1.op: unknown operation \"frobnicate\"\n",
+		},
+		{
+			name:        "wrong content type",
+			contentType: "application/json",
+			body:        `{"name": "sweet"}`,
+			wantCode:    415,
+			wantBody:    "expected Content-Type: application/json-patch+json, application/merge-patch+json rather than \"application/json\"\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", "/", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestMergePatchParameter(t *testing.T) {
+	handler := convreq.Wrap(func(p convreq.MergePatch) convreq.HttpResponse {
+		return patchItem(p)
+	})
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`[]`))
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	respRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(respRecorder, req)
+	if respRecorder.Code != 415 {
+		t.Errorf("got code %d; want 415", respRecorder.Code)
+	}
+}
+
+type patchedProfile struct {
+	Bio    string `json:"bio"`
+	secret string
+}
+
+type patchedAccount struct {
+	Name     string          `json:"name"`
+	Email    string          `json:"email"`
+	Hash     string          `json:"-"`
+	Profile  *patchedProfile `json:"profile"`
+	revision int
+}
+
+func TestPatchKeepsHiddenFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch convreq.Patch
+		want  patchedAccount
+	}{
+		{
+			name:  "merge patch",
+			patch: convreq.MergePatch(`{"name": "y", "email": null, "profile": {"bio": "new"}}`),
+			want:  patchedAccount{Name: "y", Hash: "secret", Profile: &patchedProfile{Bio: "new", secret: "s"}, revision: 3},
+		},
+		{
+			name:  "json patch",
+			patch: convreq.JSONPatch{{Op: "remove", Path: "/email"}, {Op: "replace", Path: "/profile/bio", Value: []byte(`"new"`)}},
+			want:  patchedAccount{Name: "x", Hash: "secret", Profile: &patchedProfile{Bio: "new", secret: "s"}, revision: 3},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			profile := &patchedProfile{Bio: "old", secret: "s"}
+			acct := patchedAccount{Name: "x", Email: "x@example.com", Hash: "secret", Profile: profile, revision: 3}
+			if err := tc.patch.Apply(&acct); err != nil {
+				t.Fatalf("Apply failed: %v", err)
+			}
+			if !reflect.DeepEqual(acct, tc.want) {
+				t.Errorf("got %+v (profile %+v); want %+v (profile %+v)", acct, acct.Profile, tc.want, tc.want.Profile)
+			}
+			if profile.Bio != "old" {
+				t.Errorf("the original profile was modified: %+v", profile)
+			}
+		})
+	}
+}
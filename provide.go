@@ -0,0 +1,184 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/Jille/convreq/internal"
+	"github.com/Jille/convreq/respond"
+)
+
+var cleanupType = reflect.TypeOf(func() {})
+
+// provider is a function registered with WithProvider.
+type provider struct {
+	f reflect.Value
+	// second is the type of the second return value (error or HttpResponse), or nil.
+	second reflect.Type
+	// hasCleanup is set if the provider returns (T, func(), error).
+	hasCleanup bool
+}
+
+// WithProvider makes Wrap() understand an extra type for request handler signatures, produced by the function f.
+// f's parameters are resolved like those of request handlers, so a provider can depend on other providers (and on anything else Wrap() can produce, like *http.Request or a Get struct).
+// f must return T, (T, error), (T, HttpResponse) or (T, func(), error).
+// A non-nil error or HttpResponse is sent to the client instead of calling the request handler.
+// The returned func() (which may be nil) is called after the response has been sent, in reverse order of the providers being called.
+// Each provider is called at most once per request. Missing and cyclic dependencies cause Wrap() to panic.
+func WithProvider(f interface{}) WrapOption {
+	t := reflect.TypeOf(f)
+	if t == nil || t.Kind() != reflect.Func || t.IsVariadic() {
+		panic(fmt.Errorf("convreq: provider %T is not a non-variadic function", f))
+	}
+	p := &provider{f: reflect.ValueOf(f)}
+	switch {
+	case t.NumOut() == 1:
+	case t.NumOut() == 2 && (t.Out(1) == errorType || t.Out(1) == httpResponseType):
+		p.second = t.Out(1)
+	case t.NumOut() == 3 && t.Out(1) == cleanupType && t.Out(2) == errorType:
+		p.second = errorType
+		p.hasCleanup = true
+	default:
+		panic(fmt.Errorf("convreq: provider %T must return T, (T, error), (T, HttpResponse) or (T, func(), error)", f))
+	}
+	return func(wo *wrapOptions) {
+		wo.providers[t.Out(0)] = p
+	}
+}
+
+// step is a single value that needs to be produced to call a request handler.
+// Exactly one of extract and provider is set.
+type step struct {
+	extract  extractor
+	provider *provider
+	// deps are the indexes into resolver.steps of the provider's parameters.
+	deps []int
+}
+
+// resolver figures out in which order to produce values, and produces them for each request.
+type resolver struct {
+	wo    *wrapOptions
+	name  string
+	steps []step
+	index map[reflect.Type]int
+	// resolving is the path of providers being added, to detect cycles.
+	resolving []reflect.Type
+	// methods are the methods for which there are method-specific inputs (like FooPut). See methodSet.notAllowed.
+	methods methodSet
+}
+
+func (wo *wrapOptions) newResolver(name string) *resolver {
+	return &resolver{
+		wo:      wo,
+		name:    name,
+		index:   map[reflect.Type]int{},
+		methods: methodSet{},
+	}
+}
+
+// add makes sure t will be produced, and returns its index in the values returned by resolve.
+// Steps are added after their dependencies, so they can be produced in order.
+func (rs *resolver) add(t reflect.Type, neededBy *provider) int {
+	if i, ok := rs.index[t]; ok {
+		return i
+	}
+	for i, rt := range rs.resolving {
+		if rt == t {
+			var cycle []string
+			for _, c := range append(rs.resolving[i:], t) {
+				cycle = append(cycle, c.String())
+			}
+			panic(fmt.Errorf("convreq: %s: dependency cycle: %s", rs.name, strings.Join(cycle, " -> ")))
+		}
+	}
+	var s step
+	if p, ok := rs.wo.providers[t]; ok {
+		rs.resolving = append(rs.resolving, t)
+		pt := p.f.Type()
+		s.provider = p
+		s.deps = make([]int, pt.NumIn())
+		for i := 0; pt.NumIn() > i; i++ {
+			s.deps[i] = rs.add(pt.In(i), p)
+		}
+		rs.resolving = rs.resolving[:len(rs.resolving)-1]
+	} else if e := rs.wo.extractorFor(t); e != nil {
+		s.extract = e
+		if _, custom := rs.wo.extractors[t]; !custom {
+			if m, ok := formInputMethod(t); ok && m != "" {
+				rs.methods[m] = true
+			}
+		}
+	} else if neededBy != nil {
+		panic(fmt.Errorf("convreq: %s: don't know how to produce %s (needed by provider %s)", rs.name, t.String(), neededBy.f.Type().String()))
+	} else {
+		panic(fmt.Errorf("convreq: %s: don't know how to produce %s", rs.name, t.String()))
+	}
+	rs.steps = append(rs.steps, s)
+	rs.index[t] = len(rs.steps) - 1
+	return len(rs.steps) - 1
+}
+
+// resolve produces all values for a request.
+// The returned cleanup functions should be passed to runCleanups after responding, even if a HttpResponse is returned.
+func (rs *resolver) resolve(w http.ResponseWriter, r *http.Request) ([]reflect.Value, []func(), HttpResponse) {
+	if hr := rs.methods.notAllowed(r); hr != nil {
+		return nil, nil, hr
+	}
+	vals := make([]reflect.Value, len(rs.steps))
+	var cleanups []func()
+	for i, s := range rs.steps {
+		if s.extract != nil {
+			var hr HttpResponse
+			vals[i], hr = s.extract(w, r)
+			if hr != nil {
+				return nil, cleanups, hr
+			}
+			continue
+		}
+		in := make([]reflect.Value, len(s.deps))
+		for j, d := range s.deps {
+			in[j] = vals[d]
+		}
+		outs := s.provider.f.Call(in)
+		vals[i] = outs[0]
+		if s.provider.hasCleanup {
+			if c, _ := outs[1].Interface().(func()); c != nil {
+				cleanups = append(cleanups, c)
+			}
+		}
+		switch s.provider.second {
+		case errorType:
+			if err, _ := outs[len(outs)-1].Interface().(error); err != nil {
+				return nil, cleanups, respond.Error(err)
+			}
+		case httpResponseType:
+			if hr, _ := outs[1].Interface().(HttpResponse); !internal.IsNilResponse(hr) {
+				return nil, cleanups, hr
+			}
+		}
+	}
+	return vals, cleanups, nil
+}
+
+// runCleanups calls the cleanup functions returned by providers in reverse order.
+func runCleanups(cleanups []func()) {
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+type session struct {
+	id string
+}
+
+type user struct {
+	name string
+}
+
+type tx struct{}
+
+func TestWithProvider(t *testing.T) {
+	var log []string
+	newSession := func(r *http.Request) (*session, convreq.HttpResponse) {
+		log = append(log, "session")
+		c, err := r.Cookie("sid")
+		if err != nil {
+			return nil, respond.Forbidden("no session")
+		}
+		var noError *respond.EventStream
+		return &session{c.Value}, noError
+	}
+	newUser := func(s *session) (*user, error) {
+		log = append(log, "user")
+		if s.id == "broken" {
+			return nil, errors.New("database down")
+		}
+		return &user{"quis"}, nil
+	}
+	newTx := func(s *session) (*tx, func(), error) {
+		log = append(log, "tx")
+		return &tx{}, func() { log = append(log, "rollback") }, nil
+	}
+	handler := convreq.Wrap(func(s *session, tx *tx, u *user) convreq.HttpResponse {
+		log = append(log, "handler")
+		return respond.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log = append(log, "respond")
+			w.Write([]byte(u.name))
+		}))
+	}, convreq.WithProvider(newUser), convreq.WithProvider(newSession), convreq.WithProvider(newTx))
+
+	tests := []struct {
+		sid      string
+		wantCode int
+		wantLog  string
+	}{
+		{
+			sid:      "s3cr3t",
+			wantCode: 200,
+			wantLog:  "session tx user handler respond rollback",
+		},
+		{
+			sid:      "",
+			wantCode: 403,
+			wantLog:  "session",
+		},
+		{
+			sid:      "broken",
+			wantCode: 500,
+			wantLog:  "session tx user rollback",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.sid, func(t *testing.T) {
+			log = nil
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.sid != "" {
+				req.AddCookie(&http.Cookie{Name: "sid", Value: tc.sid})
+			}
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := strings.Join(log, " "); got != tc.wantLog {
+				t.Errorf("got calls %q; want %q", got, tc.wantLog)
+			}
+		})
+	}
+}
+
+func TestWithProviderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []convreq.WrapOption
+		wantErr string
+	}{
+		{
+			name:    "missing",
+			opts:    []convreq.WrapOption{convreq.WithProvider(func(s *session) *user { return nil })},
+			wantErr: "don't know how to produce *convreq_test.session (needed by provider func(*convreq_test.session) *convreq_test.user)",
+		},
+		{
+			name: "cycle",
+			opts: []convreq.WrapOption{
+				convreq.WithProvider(func(s *session) *user { return nil }),
+				convreq.WithProvider(func(u *user) *session { return nil }),
+			},
+			wantErr: "dependency cycle: *convreq_test.user -> *convreq_test.session -> *convreq_test.user",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				err, _ := recover().(error)
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Wrap panicked with %v; want %q", err, tc.wantErr)
+				}
+			}()
+			convreq.Wrap(func(u *user) {}, tc.opts...)
+		})
+	}
+}
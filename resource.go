@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/Jille/convreq/respond"
+)
+
+// resourceMethods maps the method names WrapResource looks for to their HTTP method, in the order they're listed in the Allow header.
+var resourceMethods = []struct {
+	name   string
+	method string
+}{
+	{"Get", "GET"},
+	{"Head", "HEAD"},
+	{"Post", "POST"},
+	{"Put", "PUT"},
+	{"Patch", "PATCH"},
+	{"Delete", "DELETE"},
+	{"Options", "OPTIONS"},
+}
+
+// WrapResource returns a http.Handler that dispatches requests to the methods of v named after the HTTP method (Get, Post, Put, Patch, Delete, Head and Options).
+// Each of them is wrapped with Wrap() and can have any signature Wrap() supports.
+// HEAD requests are handled by Get if there's no Head method, and OPTIONS requests are answered with an Allow header if there's no Options method.
+// Other methods get a 405 Method Not Allowed.
+func WrapResource(v interface{}, opts ...WrapOption) http.Handler {
+	rv := reflect.ValueOf(v)
+	handlers := map[string]http.Handler{}
+	for _, m := range resourceMethods {
+		if f := rv.MethodByName(m.name); f.IsValid() {
+			handlers[m.method] = Wrap(f.Interface(), opts...)
+		}
+	}
+	if len(handlers) == 0 {
+		panic(fmt.Errorf("convreq: %T has no methods named after HTTP methods", v))
+	}
+	if _, ok := handlers["HEAD"]; !ok && handlers["GET"] != nil {
+		handlers["HEAD"] = handlers["GET"]
+	}
+	var methods []string
+	for _, m := range resourceMethods {
+		if _, ok := handlers[m.method]; ok || m.method == "OPTIONS" {
+			methods = append(methods, m.method)
+		}
+	}
+	allow := strings.Join(methods, ", ")
+	if _, ok := handlers["OPTIONS"]; !ok {
+		handlers["OPTIONS"] = Wrap(func() HttpResponse {
+			return respond.WithHeader(respond.NoContent(), "Allow", allow)
+		}, opts...)
+	}
+	notAllowed := Wrap(func(r *http.Request) HttpResponse {
+		return respond.WithHeader(respond.MethodNotAllowed(fmt.Sprintf("method %s not allowed", r.Method)), "Allow", allow)
+	}, opts...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := handlers[r.Method]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		notAllowed.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+type itemResource struct {
+	name string
+}
+
+func (i *itemResource) Get(ctx context.Context) convreq.HttpResponse {
+	return respond.String(i.name)
+}
+
+func (i *itemResource) Put(put *itemPut) (string, error) {
+	i.name = put.Name
+	return i.name, nil
+}
+
+func TestWrapResource(t *testing.T) {
+	handler := convreq.WrapResource(&itemResource{name: "quis"})
+	tests := []struct {
+		method    string
+		body      string
+		wantCode  int
+		wantBody  string
+		wantAllow string
+	}{
+		{method: "GET", wantCode: 200, wantBody: "quis"},
+		{method: "HEAD", wantCode: 200, wantBody: "quis"},
+		{method: "PUT", body: "name=dude", wantCode: 200, wantBody: "\"dude\"\n"},
+		{method: "OPTIONS", wantCode: 204, wantAllow: "GET, HEAD, PUT, OPTIONS"},
+		{method: "DELETE", wantCode: 405, wantBody: "method DELETE not allowed\n", wantAllow: "GET, HEAD, PUT, OPTIONS"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.method, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+			if got := respRecorder.Header().Get("Allow"); got != tc.wantAllow {
+				t.Errorf("got Allow header %q; want %q", got, tc.wantAllow)
+			}
+		})
+	}
+}
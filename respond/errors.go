@@ -15,11 +15,15 @@
 package respond
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/Jille/convreq/internal"
 )
 
+// FieldError describes why the value of a single input field was rejected.
+type FieldError = internal.FieldError
+
 type httpError struct {
 	code int
 	msg  string
@@ -38,6 +42,28 @@ func (e httpError) Respond(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+type fieldsError struct {
+	httpError
+	fields internal.FieldErrors
+}
+
+// Respond implements convreq.HttpResponse.
+func (e fieldsError) Respond(w http.ResponseWriter, r *http.Request) error {
+	if f, ok := r.Context().Value(internal.FieldErrorHandlerContextKey).(internal.FieldErrorHandler); ok {
+		return f(e.code, e.msg, e.fields, r).Respond(w, r)
+	}
+	if _, ok := r.Context().Value(internal.ErrorHandlerContextKey).(internal.ErrorHandler); ok {
+		return e.httpError.Respond(w, r)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.code)
+	return json.NewEncoder(w).Encode(struct {
+		Error  string               `json:"error"`
+		Fields internal.FieldErrors `json:"fields"`
+	}{e.msg, e.fields})
+}
+
 // Error creates a HTTP 500 Internal Server Error response.
 func Error(err error) internal.HttpResponse {
 	return httpError{500, err.Error()}
@@ -74,6 +100,11 @@ func BadRequest(msg string) internal.HttpResponse {
 	return httpError{400, msg}
 }
 
+// Unauthorized creates a HTTP 401 Unauthorized response.
+func Unauthorized(msg string) internal.HttpResponse {
+	return httpError{401, msg}
+}
+
 // Forbidden creates a HTTP 403 Forbidden response.
 func Forbidden(msg string) internal.HttpResponse {
 	return httpError{403, msg}
@@ -150,7 +181,11 @@ func Imateapot(msg string) internal.HttpResponse {
 }
 
 // UnprocessableEntity creates a HTTP 422 Unprocessable Entity response.
-func UnprocessableEntity(msg string) internal.HttpResponse {
+// If any fields are given, they're passed to the FieldErrorHandler, if one is set. Otherwise the response is a JSON object with the message as "error" and the fields as "fields", unless an ErrorHandler is set.
+func UnprocessableEntity(msg string, fields ...FieldError) internal.HttpResponse {
+	if len(fields) > 0 {
+		return fieldsError{httpError{422, msg}, fields}
+	}
 	return httpError{422, msg}
 }
 
@@ -29,3 +29,26 @@ func JSON(data interface{}) internal.HttpResponse {
 func ServeJSON(data interface{}) internal.HttpResponse {
 	return JSON(data)
 }
+
+type paginated struct {
+	items interface{}
+	next  *internal.Page
+}
+
+func (p paginated) Respond(w http.ResponseWriter, r *http.Request) error {
+	links, err := internal.PageLinks(r, p.next)
+	if err != nil {
+		return Error(err).Respond(w, r)
+	}
+	if links != "" {
+		w.Header().Set("Link", links)
+	}
+	return respondJSON{p.items}.Respond(w, r)
+}
+
+// Paginated sends items as JSON, with a Link header (RFC 8288) pointing to the next page and the previous one.
+// next is the page after the one that was requested, like page.Next() or page.NextCursor(c) for the convreq.Page the handler got, or nil if this is the last page.
+// Cursor pages need a CursorKey in the PageOptions (see convreq.WithPageOptions); without one the response is a 500 Internal Server Error.
+func Paginated(items interface{}, next *internal.Page) internal.HttpResponse {
+	return paginated{items, next}
+}
@@ -15,6 +15,9 @@
 package respond
 
 import (
+	"bufio"
+	"io"
+	"net"
 	"net/http"
 
 	"github.com/Jille/convreq/internal"
@@ -45,6 +48,37 @@ func (w *modifyingResponseWriter) WriteHeader(statusCode int) {
 	w.codeWritten = true
 }
 
+// Flush implements http.Flusher.
+func (w *modifyingResponseWriter) Flush() {
+	_ = w.FlushError()
+}
+
+// FlushError flushes the response like Flush, or returns http.ErrNotSupported if the wrapped ResponseWriter can't flush. It's used by http.ResponseController.
+func (w *modifyingResponseWriter) FlushError() error {
+	if !w.codeWritten {
+		w.WriteHeader(w.code)
+	}
+	return flushError(w.w)
+}
+
+// Hijack implements http.Hijacker.
+func (w *modifyingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.w)
+}
+
+// ReadFrom implements io.ReaderFrom.
+func (w *modifyingResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.codeWritten {
+		w.WriteHeader(w.code)
+	}
+	return readFrom(w.w, r)
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (w *modifyingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.w
+}
+
 type modifyingResponse struct {
 	parent internal.HttpResponse
 	code   int
@@ -60,7 +94,8 @@ func (m modifyingResponse) Respond(w http.ResponseWriter, r *http.Request) error
 }
 
 // OverrideResponseCode wraps a response to override the status code with the one given to this function.
-// Note that this replaces the original ResponseWriter with an internal one, possibly not implementing interfaces like Flusher.
+// The original ResponseWriter is wrapped by one that forwards http.Flusher, http.Hijacker and io.ReaderFrom, so streaming responses keep working.
+// Its FlushError method (used by http.ResponseController) returns http.ErrNotSupported if the original ResponseWriter can't flush.
 func OverrideResponseCode(hr internal.HttpResponse, code int) internal.HttpResponse {
 	return modifyingResponse{
 		parent: hr,
@@ -0,0 +1,183 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respond
+
+import (
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Jille/convreq/internal"
+)
+
+type respondXML struct {
+	data interface{}
+}
+
+// Respond implements convreq.HttpResponse.
+func (rx respondXML) Respond(w http.ResponseWriter, r *http.Request) error {
+	b, err := xml.Marshal(rx.data)
+	if err != nil {
+		return Error(fmt.Errorf("failed to marshal XML: %v", err)).Respond(w, r)
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// XML marshals the given data as XML and sends it to the requester.
+func XML(data interface{}) internal.HttpResponse {
+	return respondXML{data}
+}
+
+// NegotiateOptions configures which representations Negotiate can pick from. JSON is always available.
+type NegotiateOptions struct {
+	// HTML renders the data as text/html, like an html/template.Template. It's not offered if nil.
+	HTML Template
+	// Text renders the data as text/plain, like a text/template.Template. It's not offered if nil.
+	Text Template
+	// XML offers the data marshaled by encoding/xml as application/xml.
+	XML bool
+}
+
+type representation struct {
+	mediaType string
+	respond   func(data interface{}) internal.HttpResponse
+}
+
+// representations returns what o offers, in order of preference for clients that accept them equally.
+func (o NegotiateOptions) representations() []representation {
+	ret := []representation{{"application/json", JSON}}
+	if o.HTML != nil {
+		ret = append(ret, representation{"text/html", func(data interface{}) internal.HttpResponse {
+			return WithHeader(RenderTemplate(o.HTML, data), "Content-Type", "text/html; charset=utf-8")
+		}})
+	}
+	if o.XML {
+		ret = append(ret, representation{"application/xml", XML})
+	}
+	if o.Text != nil {
+		ret = append(ret, representation{"text/plain", func(data interface{}) internal.HttpResponse {
+			return WithHeader(RenderTemplate(o.Text, data), "Content-Type", "text/plain; charset=utf-8")
+		}})
+	}
+	return ret
+}
+
+type negotiated struct {
+	data interface{}
+	opts NegotiateOptions
+}
+
+// Respond implements convreq.HttpResponse.
+func (n negotiated) Respond(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Add("Vary", "Accept")
+	reps := n.opts.representations()
+	accept := parseAccept(r.Header.Values("Accept"))
+	var best *representation
+	var bestQ float64
+	for i, rep := range reps {
+		if q := accept.quality(rep.mediaType); q > bestQ {
+			best, bestQ = &reps[i], q
+		}
+	}
+	if best == nil {
+		types := make([]string, len(reps))
+		for i, rep := range reps {
+			types[i] = rep.mediaType
+		}
+		return NotAcceptable("none of the accepted media types is available; supported are "+strings.Join(types, ", ")).Respond(w, r)
+	}
+	return best.respond(n.data).Respond(w, r)
+}
+
+// Negotiate creates a response that sends data in the representation the client prefers according to its Accept header: JSON, or one of those enabled by opts.
+// If the client accepts none of them, it gets a 406 Not Acceptable listing the supported types.
+func Negotiate(data interface{}, opts NegotiateOptions) internal.HttpResponse {
+	return negotiated{data, opts}
+}
+
+// mediaRange is an entry of an Accept header.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+type acceptHeader []mediaRange
+
+// parseAccept parses Accept headers. Without any, everything is accepted.
+func parseAccept(values []string) acceptHeader {
+	var ret acceptHeader
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if strings.TrimSpace(s) == "" {
+				continue
+			}
+			mt, params, err := mime.ParseMediaType(s)
+			if err != nil {
+				continue
+			}
+			typ, subtype, ok := strings.Cut(mt, "/")
+			if !ok {
+				continue
+			}
+			mr := mediaRange{typ: typ, subtype: subtype, q: 1}
+			if qs, ok := params["q"]; ok {
+				q, err := strconv.ParseFloat(qs, 64)
+				if err != nil || q < 0 || q > 1 {
+					continue
+				}
+				mr.q = q
+			}
+			ret = append(ret, mr)
+		}
+	}
+	if ret == nil {
+		ret = acceptHeader{{typ: "*", subtype: "*", q: 1}}
+	}
+	return ret
+}
+
+// quality returns the q-value of the most specific media range that matches mediaType, or 0 if none match.
+func (a acceptHeader) quality(mediaType string) float64 {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	bestSpecificity := -1
+	var q float64
+	for _, mr := range a {
+		var specificity int
+		switch {
+		case mr.typ == typ && mr.subtype == subtype:
+			specificity = 2
+		case mr.typ == typ && mr.subtype == "*":
+			specificity = 1
+		case mr.typ == "*" && mr.subtype == "*":
+			specificity = 0
+		default:
+			continue
+		}
+		if specificity > bestSpecificity {
+			bestSpecificity, q = specificity, mr.q
+		}
+	}
+	return q
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respond
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHeartbeat is how often an EventStream sends a comment to keep the connection open, unless changed with EventStream.Heartbeat.
+const DefaultHeartbeat = 15 * time.Second
+
+// Event is a Server-Sent Event. Only Data is required.
+type Event struct {
+	// ID is sent back by the client in the Last-Event-ID header when it reconnects. See convreq.LastEventID.
+	ID string
+	// Event is the type of the event. Clients receive events without a type as "message".
+	Event string
+	// Data is the payload of the event. It may contain newlines.
+	Data string
+	// Retry tells the client how long to wait before reconnecting, if it's not zero.
+	Retry time.Duration
+}
+
+// EventStream is a response that streams Server-Sent Events (text/event-stream) to the client.
+type EventStream struct {
+	events    <-chan Event
+	f         func(ctx context.Context, send func(Event) error) error
+	heartbeat time.Duration
+}
+
+// SSE creates a response that streams the events from the channel until it's closed or the request is canceled.
+func SSE(events <-chan Event) *EventStream {
+	return &EventStream{events: events, heartbeat: DefaultHeartbeat}
+}
+
+// SSEFunc creates a response that streams the events f sends until f returns.
+// send returns an error once the request is canceled or the client is gone, which f should return (possibly wrapped).
+func SSEFunc(f func(ctx context.Context, send func(Event) error) error) *EventStream {
+	return &EventStream{f: f, heartbeat: DefaultHeartbeat}
+}
+
+// Heartbeat changes how often a comment is sent while there are no events, to keep proxies from closing the connection. Zero disables heartbeats.
+func (s *EventStream) Heartbeat(d time.Duration) *EventStream {
+	s.heartbeat = d
+	return s
+}
+
+// eventWriter writes events to the response and flushes them.
+type eventWriter struct {
+	mtx sync.Mutex
+	w   http.ResponseWriter
+	err error
+}
+
+var errStreamEnded = errors.New("event stream has ended")
+
+func (ew *eventWriter) write(s string) error {
+	ew.mtx.Lock()
+	defer ew.mtx.Unlock()
+	if ew.err != nil {
+		return ew.err
+	}
+	if _, err := io.WriteString(ew.w, s); err != nil {
+		ew.err = err
+		return err
+	}
+	flush(ew.w)
+	return nil
+}
+
+// formatEvent returns the wire format of e.
+func formatEvent(e Event) string {
+	var sb strings.Builder
+	// IDs and types can't contain newlines, as those would end the field.
+	if e.ID != "" {
+		fmt.Fprintf(&sb, "id: %s\n", strings.NewReplacer("\r", "", "\n", "").Replace(e.ID))
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&sb, "event: %s\n", strings.NewReplacer("\r", "", "\n", "").Replace(e.Event))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&sb, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	// \r\n, \r and \n all end a line, so each of them starts a new data field.
+	for _, line := range strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(e.Data), "\n") {
+		fmt.Fprintf(&sb, "data: %s\n", line)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// Respond implements convreq.HttpResponse.
+func (s *EventStream) Respond(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+	ew := &eventWriter{w: w}
+	if err := ew.write(""); err != nil {
+		return err
+	}
+	ctx := r.Context()
+	var tick <-chan time.Time
+	if s.heartbeat > 0 {
+		t := time.NewTicker(s.heartbeat)
+		defer t.Stop()
+		tick = t.C
+	}
+	if s.f != nil {
+		return s.respondFunc(ctx, ew, tick)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick:
+			if err := ew.write(": heartbeat\n\n"); err != nil {
+				return err
+			}
+		case e, ok := <-s.events:
+			if !ok {
+				return nil
+			}
+			if err := ew.write(formatEvent(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *EventStream) respondFunc(ctx context.Context, ew *eventWriter, tick <-chan time.Time) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-tick:
+				ew.write(": heartbeat\n\n")
+			}
+		}
+	}()
+	err := s.f(ctx, func(e Event) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ew.write(formatEvent(e))
+	})
+	// Wait for a heartbeat that's being written, and prevent new ones, as the ResponseWriter can't be used after we return.
+	ew.mtx.Lock()
+	ew.err = errStreamEnded
+	ew.mtx.Unlock()
+	if err != nil && ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		// The client went away, which is the normal way for a stream to end.
+		return nil
+	}
+	return err
+}
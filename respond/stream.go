@@ -0,0 +1,122 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respond
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/Jille/convreq/internal"
+)
+
+// StreamWriter is what the function passed to Stream writes the response to.
+type StreamWriter interface {
+	io.Writer
+	// Header returns the headers of the response. Changes after the response is committed have no effect.
+	Header() http.Header
+	// WriteHeader sends the status code and headers. It's called with 200 on the first Write if it wasn't called before.
+	WriteHeader(code int)
+	// Flush sends what has been written so far to the client, if the underlying ResponseWriter supports it.
+	Flush()
+	// Committed returns whether the status code and headers have been sent, after which an error can no longer be turned into an error response.
+	Committed() bool
+}
+
+type streamWriter struct {
+	w         http.ResponseWriter
+	committed bool
+}
+
+func (sw *streamWriter) Header() http.Header {
+	return sw.w.Header()
+}
+
+func (sw *streamWriter) WriteHeader(code int) {
+	if sw.committed {
+		return
+	}
+	sw.committed = true
+	sw.w.WriteHeader(code)
+}
+
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	sw.WriteHeader(200)
+	return sw.w.Write(b)
+}
+
+func (sw *streamWriter) Flush() {
+	_ = sw.FlushError()
+}
+
+func (sw *streamWriter) FlushError() error {
+	sw.WriteHeader(200)
+	return flushError(sw.w)
+}
+
+func (sw *streamWriter) ReadFrom(r io.Reader) (int64, error) {
+	sw.WriteHeader(200)
+	return readFrom(sw.w, r)
+}
+
+func (sw *streamWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, brw, err := hijack(sw.w)
+	if err == nil {
+		sw.committed = true
+	}
+	return c, brw, err
+}
+
+func (sw *streamWriter) Unwrap() http.ResponseWriter {
+	return sw.w
+}
+
+func (sw *streamWriter) Committed() bool {
+	return sw.committed
+}
+
+type respondStream struct {
+	f func(w StreamWriter) error
+}
+
+// Respond implements convreq.HttpResponse.
+func (rs respondStream) Respond(w http.ResponseWriter, r *http.Request) error {
+	sw := &streamWriter{w: w}
+	orig := w.Header().Clone()
+	err := rs.f(sw)
+	if err == nil {
+		return nil
+	}
+	if !sw.committed {
+		// Drop the headers f set for its own response, like Content-Disposition.
+		h := w.Header()
+		for k := range h {
+			delete(h, k)
+		}
+		for k, v := range orig {
+			h[k] = v
+		}
+		return Error(err).Respond(w, r)
+	}
+	return fmt.Errorf("stream failed after the response was committed: %w", err)
+}
+
+// Stream creates a response that's written progressively by f, like a long report.
+// If f fails before anything was written, the headers it set are dropped and the error is rendered like respond.Error. Later errors are passed to the ResponseErrorHandler (see convreq.WithResponseErrorHandler).
+func Stream(f func(w StreamWriter) error) internal.HttpResponse {
+	return respondStream{f}
+}
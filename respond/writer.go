@@ -0,0 +1,64 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respond
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// The ResponseWriters in this package wrap the one they're given, and forward the optional interfaces http.Flusher, http.Hijacker and io.ReaderFrom to it with these helpers.
+// They also have an Unwrap method, which http.ResponseController uses to find the methods it needs, and a FlushError method so it learns when flushing isn't supported.
+
+// flush flushes w if it supports that.
+func flush(w http.ResponseWriter) {
+	_ = flushError(w)
+}
+
+// flushError flushes w, looking through Unwrap methods like http.ResponseController does, or returns http.ErrNotSupported if it can't.
+func flushError(w http.ResponseWriter) error {
+	for {
+		switch t := w.(type) {
+		case interface{ FlushError() error }:
+			return t.FlushError()
+		case http.Flusher:
+			t.Flush()
+			return nil
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return http.ErrNotSupported
+		}
+	}
+}
+
+// hijack hijacks the connection of w, or returns http.ErrNotSupported if it can't.
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// readFrom copies r to w, using the ReadFrom method of w if it has one, so that net/http can use sendfile.
+func readFrom(w http.ResponseWriter, r io.Reader) (int64, error) {
+	if rf, ok := w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	// Hide any methods of w other than Write, so io.Copy can't call back into a wrapper.
+	return io.Copy(struct{ io.Writer }{w}, r)
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+func TestSSE(t *testing.T) {
+	handler := convreq.Wrap(func(last convreq.LastEventID) convreq.HttpResponse {
+		ch := make(chan respond.Event, 2)
+		ch <- respond.Event{ID: "8", Event: "resumed", Data: string(last)}
+		ch <- respond.Event{Data: "line 1\nline 2\rid: 9\r\nline 4", Retry: 3 * time.Second}
+		close(ch)
+		return respond.SSE(ch)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Last-Event-ID", "7")
+	respRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(respRecorder, req)
+	if got, want := respRecorder.Header().Get("Content-Type"), "text/event-stream"; got != want {
+		t.Errorf("got Content-Type %q; want %q", got, want)
+	}
+	want := "id: 8\nevent: resumed\ndata: 7\n\nretry: 3000\ndata: line 1\ndata: line 2\ndata: id: 9\ndata: line 4\n\n"
+	if got := respRecorder.Body.String(); got != want {
+		t.Errorf("got body %q; want %q", got, want)
+	}
+	if !respRecorder.Flushed {
+		t.Errorf("response wasn't flushed")
+	}
+}
+
+func TestSSEFuncHeartbeat(t *testing.T) {
+	handler := convreq.Wrap(func(ctx context.Context) convreq.HttpResponse {
+		return respond.SSEFunc(func(ctx context.Context, send func(respond.Event) error) error {
+			if err := send(respond.Event{Data: "hello"}); err != nil {
+				return err
+			}
+			<-ctx.Done()
+			if err := send(respond.Event{Data: "too late"}); err != nil {
+				return fmt.Errorf("failed to send: %w", err)
+			}
+			return nil
+		}).Heartbeat(5 * time.Millisecond)
+	}, convreq.WithResponseErrorHandler(func(r *http.Request, err error) {
+		t.Errorf("ResponseErrorHandler got %v; the client going away isn't an error", err)
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	respRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(respRecorder, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	body := respRecorder.Body.String()
+	if !strings.HasPrefix(body, "data: hello\n\n: heartbeat\n\n") {
+		t.Errorf("got body %q; want it to start with the event and a heartbeat", body)
+	}
+	if strings.Contains(body, "too late") {
+		t.Errorf("got body %q; didn't want events after the request was canceled", body)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+func TestStream(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name        string
+		failAfter   int
+		wantCode    int
+		wantBody    string
+		wantErr     bool
+		wantFlushed bool
+		// wantDisposition is the Content-Disposition set by the stream, which is dropped if the error is rendered.
+		wantDisposition string
+	}{
+		{
+			name:            "complete",
+			failAfter:       -1,
+			wantCode:        200,
+			wantBody:        "row 0\nrow 1\nrow 2\n",
+			wantFlushed:     true,
+			wantDisposition: "attachment",
+		},
+		{
+			name:      "fails before writing",
+			failAfter: 0,
+			wantCode:  500,
+			wantBody:  "boom\n",
+		},
+		{
+			name:            "fails halfway",
+			failAfter:       2,
+			wantCode:        200,
+			wantBody:        "row 0\nrow 1\n",
+			wantErr:         true,
+			wantFlushed:     true,
+			wantDisposition: "attachment",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotErr error
+			handler := convreq.Wrap(func() convreq.HttpResponse {
+				return respond.WithHeader(respond.Stream(func(w respond.StreamWriter) error {
+					w.Header().Set("Content-Type", "text/plain")
+					w.Header().Set("Content-Disposition", "attachment")
+					for i := 0; 3 > i; i++ {
+						if i == tc.failAfter {
+							return errBoom
+						}
+						fmt.Fprintf(w, "row %d\n", i)
+						w.Flush()
+						if !w.Committed() {
+							t.Errorf("Committed() = false after writing")
+						}
+					}
+					return nil
+				}), "X-Report", "1")
+			}, convreq.WithResponseErrorHandler(func(r *http.Request, err error) {
+				gotErr = err
+			}))
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, httptest.NewRequest("GET", "/", nil))
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+			if got := respRecorder.Header().Get("Content-Disposition"); got != tc.wantDisposition {
+				t.Errorf("got Content-Disposition %q; want %q", got, tc.wantDisposition)
+			}
+			if got := respRecorder.Header().Get("X-Report"); got != "1" {
+				t.Errorf("got X-Report %q; want the header set before streaming to be kept", got)
+			}
+			if respRecorder.Flushed != tc.wantFlushed {
+				t.Errorf("got Flushed %v; want %v", respRecorder.Flushed, tc.wantFlushed)
+			}
+			if errors.Is(gotErr, errBoom) != tc.wantErr {
+				t.Errorf("ResponseErrorHandler got %v; want errBoom: %v", gotErr, tc.wantErr)
+			}
+		})
+	}
+}
+
+// readFromRecorder is a ResponseRecorder that records whether its ReadFrom and Hijack methods were called.
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+	hijacked bool
+}
+
+func (r *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.readFrom = true
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func (r *readFromRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	return nil, nil, nil
+}
+
+func TestOverrideResponseCodeForwards(t *testing.T) {
+	handler := convreq.Wrap(func() convreq.HttpResponse {
+		return respond.OverrideResponseCode(respond.Stream(func(w respond.StreamWriter) error {
+			// Hide the WriteTo method of the strings.Reader, so io.Copy uses ReadFrom.
+			if _, err := io.Copy(w, struct{ io.Reader }{strings.NewReader("report")}); err != nil {
+				return err
+			}
+			w.(http.Flusher).Flush()
+			if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+				return err
+			}
+			if got := w.(interface{ Unwrap() http.ResponseWriter }).Unwrap(); got == nil {
+				t.Errorf("Unwrap() returned nil")
+			}
+			return nil
+		}), 203)
+	})
+	rec := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != 203 {
+		t.Errorf("got code %d; want 203", rec.Code)
+	}
+	if got := rec.Body.String(); got != "report" {
+		t.Errorf("got body %q; want %q", got, "report")
+	}
+	if !rec.readFrom {
+		t.Errorf("ReadFrom wasn't forwarded")
+	}
+	if !rec.Flushed {
+		t.Errorf("Flush wasn't forwarded")
+	}
+	if !rec.hijacked {
+		t.Errorf("Hijack wasn't forwarded")
+	}
+}
+
+// plainWriter is a ResponseWriter without any of the optional interfaces.
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func TestFlushErrorNotSupported(t *testing.T) {
+	var gotErr error
+	hr := respond.OverrideResponseCode(respond.Stream(func(w respond.StreamWriter) error {
+		gotErr = w.(interface{ FlushError() error }).FlushError()
+		return nil
+	}), 203)
+	rec := httptest.NewRecorder()
+	if err := hr.Respond(plainWriter{rec}, httptest.NewRequest("GET", "/", nil)); err != nil {
+		t.Fatalf("Respond failed: %v", err)
+	}
+	if gotErr != http.ErrNotSupported {
+		t.Errorf("FlushError() = %v; want http.ErrNotSupported", gotErr)
+	}
+	if rec.Flushed {
+		t.Errorf("the recorder was flushed through a writer that can't flush")
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convreq_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Jille/convreq"
+	"github.com/Jille/convreq/respond"
+)
+
+type SignupGet struct {
+	Name    string `schema:"name" validate:"required,min=2,max=10"`
+	Email   string `schema:"email" validate:"omitempty,email"`
+	Website string `schema:"website" validate:"omitempty,url"`
+	Color   string `schema:"color" validate:"omitempty,oneof=red green blue"`
+	Zip     string `schema:"zip" validate:"omitempty,len=4,regexp=^[0-9]+$"`
+	Age     int    `schema:"age" validate:"omitempty,min=18"`
+}
+
+func (g SignupGet) Validate() error {
+	if g.Name == "root" {
+		return convreq.FieldError{Field: "name", Reason: "is reserved"}
+	}
+	return nil
+}
+
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			query:    "?name=quis&email=quis@example.com&website=https://example.com/&color=red&zip=1234&age=18",
+			wantCode: 200,
+			wantBody: "ok",
+		},
+		{
+			query:    "",
+			wantCode: 422,
+			wantBody: `{"error":"name: is required","fields":[{"field":"name","reason":"is required"}]}` + "\n",
+		},
+		{
+			query:    "?name=q&email=quis&website=example.com&color=pink&zip=12a4&age=17",
+			wantCode: 422,
+			wantBody: `{"error":"name: must have length at least 2; email: must be an email address; website: must be a URL; color: must be one of red, green, blue; zip: must match ^[0-9]+$; age: must be at least 18","fields":[{"field":"name","reason":"must have length at least 2"},{"field":"email","reason":"must be an email address"},{"field":"website","reason":"must be a URL"},{"field":"color","reason":"must be one of red, green, blue"},{"field":"zip","reason":"must match ^[0-9]+$"},{"field":"age","reason":"must be at least 18"}]}` + "\n",
+		},
+		{
+			query:    "?name=root",
+			wantCode: 422,
+			wantBody: `{"error":"name: is reserved","fields":[{"field":"name","reason":"is reserved"}]}` + "\n",
+		},
+	}
+	handler := convreq.Wrap(func(get SignupGet) convreq.HttpResponse {
+		return respond.String("ok")
+	})
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, httptest.NewRequest("GET", "/"+tc.query, nil))
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
+
+type BadValidationGet struct {
+	Age int `validate:"oneof=1 2"`
+}
+
+func TestValidationBadTag(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Wrap didn't panic on an invalid validate tag")
+		}
+	}()
+	convreq.Wrap(func(get BadValidationGet) {})
+}
+
+func TestValidationErrorHandler(t *testing.T) {
+	eh := func(code int, msg string, r *http.Request) convreq.HttpResponse {
+		return respond.Printf("%d: %s", code, msg)
+	}
+	respRecorder := httptest.NewRecorder()
+	convreq.Wrap(func(get SignupGet) {}, convreq.WithErrorHandler(eh)).ServeHTTP(respRecorder, httptest.NewRequest("GET", "/", nil))
+	if got, want := respRecorder.Body.String(), "422: name: is required"; got != want {
+		t.Errorf("got body %q; want %q", got, want)
+	}
+}
+
+type OrderGet struct {
+	Count    int    `schema:"count" validate:"min=1"`
+	Quantity int    `schema:"quantity" validate:"required,min=1"`
+	Limit    *int   `schema:"limit" validate:"min=1"`
+	Sort     string `schema:"sort" validate:"oneof=asc desc"`
+	Coupon   string `schema:"coupon" validate:"omitempty,len=6"`
+}
+
+func TestValidationZeroValues(t *testing.T) {
+	tests := []struct {
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			query:    "?count=1&quantity=1&sort=asc",
+			wantCode: 200,
+			wantBody: "ok",
+		},
+		{
+			query:    "?count=0&quantity=1&sort=asc",
+			wantCode: 422,
+			wantBody: `{"error":"count: must be at least 1","fields":[{"field":"count","reason":"must be at least 1"}]}` + "\n",
+		},
+		{
+			query:    "?count=1&quantity=1&sort=",
+			wantCode: 422,
+			wantBody: `{"error":"sort: must be one of asc, desc","fields":[{"field":"sort","reason":"must be one of asc, desc"}]}` + "\n",
+		},
+		{
+			query:    "?count=1&quantity=0&sort=asc",
+			wantCode: 422,
+			wantBody: `{"error":"quantity: is required","fields":[{"field":"quantity","reason":"is required"}]}` + "\n",
+		},
+		{
+			query:    "?count=1&quantity=1&sort=asc&limit=0",
+			wantCode: 422,
+			wantBody: `{"error":"limit: must be at least 1","fields":[{"field":"limit","reason":"must be at least 1"}]}` + "\n",
+		},
+		{
+			query:    "?count=1&quantity=1&sort=asc&coupon=",
+			wantCode: 200,
+			wantBody: "ok",
+		},
+		{
+			query:    "?count=1&quantity=1&sort=asc&coupon=abc",
+			wantCode: 422,
+			wantBody: `{"error":"coupon: must have length 6","fields":[{"field":"coupon","reason":"must have length 6"}]}` + "\n",
+		},
+	}
+	handler := convreq.Wrap(func(get OrderGet) convreq.HttpResponse {
+		return respond.String("ok")
+	})
+	for _, tc := range tests {
+		t.Run(tc.query, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, httptest.NewRequest("GET", "/"+tc.query, nil))
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestValidationFieldErrorHandler(t *testing.T) {
+	eh := func(code int, msg string, r *http.Request) convreq.HttpResponse {
+		return respond.Printf("%d: %s", code, msg)
+	}
+	feh := func(code int, msg string, fields convreq.FieldErrors, r *http.Request) convreq.HttpResponse {
+		return respond.Printf("%d: %d fields, first %s %s", code, len(fields), fields[0].Field, fields[0].Reason)
+	}
+	respRecorder := httptest.NewRecorder()
+	convreq.Wrap(func(get SignupGet) {}, convreq.WithErrorHandler(eh), convreq.WithFieldErrorHandler(feh)).ServeHTTP(respRecorder, httptest.NewRequest("GET", "/?name=x&age=3", nil))
+	if got, want := respRecorder.Body.String(), "422: 2 fields, first name must have length at least 2"; got != want {
+		t.Errorf("got body %q; want %q", got, want)
+	}
+}
@@ -19,8 +19,10 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/Jille/convreq/genapi"
 	"github.com/Jille/convreq/internal"
 	"github.com/Jille/convreq/respond"
 )
@@ -34,17 +36,31 @@ var extractorMap = map[reflect.Type]extractor{
 	reflect.TypeOf((*context.Context)(nil)).Elem():     getContext,
 	reflect.TypeOf(&http.Request{}):                    getRequest,
 	reflect.TypeOf((*http.ResponseWriter)(nil)).Elem(): getResponseWriter,
+	reflect.TypeOf(&MultipartStream{}):                 getMultipartStream,
+	reflect.TypeOf((*Patch)(nil)).Elem():               getPatch,
+	reflect.TypeOf(MergePatch{}):                       getMergePatch,
+	reflect.TypeOf(JSONPatch{}):                        getJSONPatch,
+	reflect.TypeOf(Page{}):                             getPage,
+	reflect.TypeOf(LastEventID("")):                    getLastEventID,
 }
 
+var (
+	errorType        = reflect.TypeOf((*error)(nil)).Elem()
+	httpResponseType = reflect.TypeOf((*HttpResponse)(nil)).Elem()
+)
+
 // handlers are function that can handle the return value from a request handler.
 var handlerMap = map[reflect.Type]reflect.Value{
-	reflect.TypeOf((*error)(nil)).Elem():        reflect.ValueOf(handleError),
-	reflect.TypeOf((*HttpResponse)(nil)).Elem(): reflect.ValueOf(internal.DoRespond),
+	errorType:        reflect.ValueOf(handleError),
+	httpResponseType: reflect.ValueOf(internal.DoRespond),
 }
 
 type wrapOptions struct {
 	extractors      map[reflect.Type]extractor
+	providers       map[reflect.Type]*provider
 	handlers        map[reflect.Type]reflect.Value
+	renderer        func(data interface{}) HttpResponse
+	bodyDecoders    map[string]BodyDecoder
 	contextWrappers []func(ctx context.Context) (context.Context, func())
 }
 
@@ -67,6 +83,22 @@ func WithReturnType(t reflect.Type, f interface{}) WrapOption {
 	}
 }
 
+// WithDefaultRenderer sets how Wrap() renders the value of handlers returning (T, error) if T has no return type handler and isn't a HttpResponse.
+// The default is respond.JSON.
+func WithDefaultRenderer(f func(data interface{}) HttpResponse) WrapOption {
+	return func(wo *wrapOptions) {
+		wo.renderer = f
+	}
+}
+
+// WithBodyDecoder makes ...Body inputs understand request bodies of the given media type (like "application/cbor").
+// Media types with a structured syntax suffix (like application/problem+json) fall back to the decoder for application/json or application/xml, so registering "application/json" replaces the JSON decoder for those too.
+func WithBodyDecoder(mediaType string, d BodyDecoder) WrapOption {
+	return func(wo *wrapOptions) {
+		wo.bodyDecoders[strings.ToLower(mediaType)] = d
+	}
+}
+
 // WithContextWrapper allows you to replace the context for the request.
 // f is called just before the request gets handled, and the cancel function is called after the request is finished.
 // The cancel function may be nil.
@@ -83,12 +115,111 @@ func WithErrorHandler(f ErrorHandler) WrapOption {
 	})
 }
 
-// Wrap takes a request handler function and returns a http.HandlerFunc for use with net/http.
-// The given handler is expected to take arguments like context.Context, *http.Request and return a convreq.HttpResponse or an error.
-func Wrap(f interface{}, opts ...WrapOption) http.HandlerFunc {
-	wo := wrapOptions{
-		extractors: map[reflect.Type]extractor{},
-		handlers:   map[reflect.Type]reflect.Value{},
+// WithDecodeErrorHandler can be passed on Wrap() to set a DecodeErrorHandler for requests.
+func WithDecodeErrorHandler(f DecodeErrorHandler) WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		return ContextWithDecodeErrorHandler(ctx, f), nil
+	})
+}
+
+// WithFieldErrorHandler can be passed on Wrap() to set a FieldErrorHandler for requests.
+func WithFieldErrorHandler(f FieldErrorHandler) WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		return ContextWithFieldErrorHandler(ctx, f), nil
+	})
+}
+
+// WithDecoder can be passed on Wrap() to decode input with d rather than the default Decoder.
+func WithDecoder(d *Decoder) WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		return ContextWithDecoder(ctx, d), nil
+	})
+}
+
+// WithStrictDecoding makes Wrap() reject input with unknown query parameters, form fields and JSON fields with a 400 Bad Request.
+// Path variables, headers and cookies aren't checked. Input types can override this by implementing `StrictDecoding() bool`.
+func WithStrictDecoding() WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		return context.WithValue(ctx, internal.StrictDecodingContextKey, true), nil
+	})
+}
+
+// WithMaxBodySize sets the maximum size of request bodies in bytes. Larger requests get a 413 Payload Too Large.
+// The default is 10MB. A negative value means unlimited. Input types can override the limit by implementing `MaxBodySize() int64`.
+// Multipart forms are limited by WithMaxMultipartSize instead.
+func WithMaxBodySize(n int64) WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		l := internal.BodyLimitsFromContext(ctx)
+		l.MaxBodySize = n
+		return context.WithValue(ctx, internal.BodyLimitsContextKey, l), nil
+	})
+}
+
+// WithMaxMultipartSize sets the maximum size of multipart/form-data request bodies in bytes, including files that are stored on disk. Larger requests get a 413 Payload Too Large.
+// The default is 100MB. A negative value means unlimited. Input types can override the limit by implementing `MaxBodySize() int64`.
+// Compressed bodies of unlimited size are still limited to WithMaxBodySize after decompression.
+func WithMaxMultipartSize(n int64) WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		l := internal.BodyLimitsFromContext(ctx)
+		l.MaxMultipartSize = n
+		return context.WithValue(ctx, internal.BodyLimitsContextKey, l), nil
+	})
+}
+
+// WithMaxMultipartMemory sets how many bytes of multipart forms are kept in memory. The remainder of the files is stored in temporary files on disk.
+// The default is 32MB. The total size is limited by WithMaxMultipartSize.
+func WithMaxMultipartMemory(n int64) WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		l := internal.BodyLimitsFromContext(ctx)
+		l.MaxMultipartMemory = n
+		return context.WithValue(ctx, internal.BodyLimitsContextKey, l), nil
+	})
+}
+
+// WithMaxMultipartParts sets the maximum number of parts a MultipartStream reads. The default is 1000. Zero means unlimited.
+func WithMaxMultipartParts(n int) WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		l := internal.BodyLimitsFromContext(ctx)
+		l.MaxMultipartParts = n
+		return context.WithValue(ctx, internal.BodyLimitsContextKey, l), nil
+	})
+}
+
+// WithPageOptions configures the default and maximum limit of Page parameters and the key their cursors are signed with.
+// Pages with cursors can only be used with a CursorKey.
+// The default limit is 50 and the maximum 100, which are also used for limits that are zero in o.
+func WithPageOptions(o PageOptions) WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		return ContextWithPageOptions(ctx, o), nil
+	})
+}
+
+// WithPanicHandler can be passed on Wrap() to set a PanicHandler for requests.
+// Without a PanicHandler, panics are logged and rendered as respond.Error().
+func WithPanicHandler(f PanicHandler) WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		return ContextWithPanicHandler(ctx, f), nil
+	})
+}
+
+// WithResponseErrorHandler can be passed on Wrap() to be told about errors writing responses, like a respond.Stream that fails after it started writing.
+// Without a ResponseErrorHandler, they're logged.
+func WithResponseErrorHandler(f ResponseErrorHandler) WrapOption {
+	return WithContextWrapper(func(ctx context.Context) (context.Context, func()) {
+		return ContextWithResponseErrorHandler(ctx, f), nil
+	})
+}
+
+func newWrapOptions(opts []WrapOption) *wrapOptions {
+	wo := &wrapOptions{
+		extractors:   map[reflect.Type]extractor{},
+		providers:    map[reflect.Type]*provider{},
+		handlers:     map[reflect.Type]reflect.Value{},
+		renderer:     respond.JSON,
+		bodyDecoders: map[string]BodyDecoder{},
+	}
+	for mt, d := range internal.DefaultBodyDecoders {
+		wo.bodyDecoders[mt] = d
 	}
 	for t, e := range extractorMap {
 		wo.extractors[t] = e
@@ -97,25 +228,45 @@ func Wrap(f interface{}, opts ...WrapOption) http.HandlerFunc {
 		wo.handlers[t] = f
 	}
 	for _, o := range opts {
-		o(&wo)
+		o(wo)
+	}
+	return wo
+}
+
+// serve applies the context wrappers and calls f. Any panic in f is recovered and handled by genapi.HandlePanic.
+func (wo *wrapOptions) serve(w http.ResponseWriter, r *http.Request, f func(w http.ResponseWriter, r *http.Request)) {
+	if len(wo.contextWrappers) > 0 {
+		ctx := r.Context()
+		var cancel func()
+		for _, cw := range wo.contextWrappers {
+			ctx, cancel = cw(ctx)
+			if cancel != nil {
+				defer cancel()
+			}
+		}
+		r = r.WithContext(ctx)
 	}
+	defer func() {
+		if p := recover(); p != nil {
+			internal.DoRespond(w, r, genapi.HandlePanic(r, p))
+		}
+	}()
+	f(w, r)
+}
+
+// Wrap takes a request handler function and returns a http.HandlerFunc for use with net/http.
+// The given handler is expected to take arguments like context.Context, *http.Request and return a convreq.HttpResponse or an error.
+// Handlers can also return (T, error). If the error is non-nil it is rendered with respond.Error(), otherwise T is rendered by the handler for its type, as a HttpResponse, or with the default renderer (see WithDefaultRenderer).
+func Wrap(f interface{}, opts ...WrapOption) http.HandlerFunc {
+	wo := newWrapOptions(opts)
 
 	if fun, ok := f.(func(context.Context, *http.Request) HttpResponse); ok {
 		// Fast path without reflection for this common signature.
+		call := func(w http.ResponseWriter, r *http.Request) {
+			internal.DoRespond(w, r, fun(r.Context(), r))
+		}
 		return func(w http.ResponseWriter, r *http.Request) {
-			ctx := r.Context()
-			if len(wo.contextWrappers) > 0 {
-				var cancel func()
-				for _, cw := range wo.contextWrappers {
-					ctx, cancel = cw(ctx)
-					if cancel != nil {
-						defer cancel()
-					}
-				}
-				r = r.WithContext(ctx)
-			}
-			hr := fun(ctx, r)
-			internal.DoRespond(w, r, hr)
+			wo.serve(w, r, call)
 		}
 	}
 
@@ -127,68 +278,85 @@ func Wrap(f interface{}, opts ...WrapOption) http.HandlerFunc {
 	}
 
 	// Look up all input parameters, and look up how we can create that type based.
-	ins := make([]extractor, t.NumIn())
+	res := wo.newResolver(v.String())
+	ins := make([]int, t.NumIn())
 	for i := 0; t.NumIn() > i; i++ {
-		if e, ok := wo.extractors[t.In(i)]; ok {
-			ins[i] = e
-		} else if strings.HasSuffix(t.In(i).Name(), "Get") {
-			ins[i] = createGetInput(t.In(i))
-		} else if t.In(i).Kind() == reflect.Ptr && strings.HasSuffix(t.In(i).Elem().Name(), "Post") {
-			ins[i] = createPostInput(t.In(i))
-		} else if t.In(i).Kind() == reflect.Ptr && strings.HasSuffix(t.In(i).Elem().Name(), "JSON") {
-			ins[i] = createJSONInput(t.In(i), true)
-		} else if strings.HasSuffix(t.In(i).Name(), "JSON") {
-			ins[i] = createJSONInput(t.In(i), false)
-		}
-		if ins[i] == nil {
-			panic(fmt.Errorf("convreq: %s: don't know how to produce %s", v.String(), t.In(i).String()))
-		}
+		ins[i] = res.add(t.In(i), nil)
 	}
 	if t.IsVariadic() {
 		panic(fmt.Errorf("convreq: %s: can't use variadic functions", v.String()))
 	}
 
 	// Figure out how to handle return values.
-	var handler reflect.Value
+	var handler func(w http.ResponseWriter, r *http.Request, outs []reflect.Value)
 	switch t.NumOut() {
 	case 0:
-		handler = reflect.ValueOf(handleVoid)
+		handler = handleVoid
 	case 1:
-		handler = wo.handlers[t.Out(0)]
+		if h, ok := wo.handlers[t.Out(0)]; ok {
+			handler = callHandler(h)
+		}
+	case 2:
+		if t.Out(1) == errorType {
+			handler = wo.createValueErrorHandler(t.Out(0))
+		}
 	}
-	if !handler.IsValid() {
+	if handler == nil {
 		panic(fmt.Errorf("convreq: %s: don't know how to handle return type(s)", v.String()))
 	}
 
 	// We've done all the prework we can. We try to minimize the things on the request path.
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		if len(wo.contextWrappers) > 0 {
-			ctx := r.Context()
-			var cancel func()
-			for _, cw := range wo.contextWrappers {
-				ctx, cancel = cw(ctx)
-				if cancel != nil {
-					defer cancel()
-				}
-			}
-			r = r.WithContext(ctx)
-		}
-		var hr HttpResponse
+	call := func(w http.ResponseWriter, r *http.Request) {
 		// Now that we're called, extract all input parameters from w and r.
+		vals, cleanups, hr := res.resolve(w, r)
+		defer runCleanups(cleanups)
+		if hr != nil {
+			internal.DoRespond(w, r, hr)
+			return
+		}
 		in := make([]reflect.Value, len(ins))
-		for i, e := range ins {
-			in[i], hr = e(w, r)
-			if hr != nil {
-				internal.DoRespond(w, r, hr)
-				return
-			}
+		for i, idx := range ins {
+			in[i] = vals[idx]
 		}
 		// Call the user's handler function.
 		outs := v.Call(in)
 		// Handle the return value.
-		handler.Call(append([]reflect.Value{reflect.ValueOf(w), reflect.ValueOf(r)}, outs...))
+		handler(w, r, outs)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		wo.serve(w, r, call)
+	}
+}
+
+// extractorFor returns the extractor for parameters of type t, or nil if we don't know how to produce a t.
+func (wo *wrapOptions) extractorFor(t reflect.Type) extractor {
+	if e, ok := wo.extractors[t]; ok {
+		return e
+	} else if t.Kind() == reflect.Ptr && t.Implements(jsonStreamType) {
+		return createJSONStream(t)
+	} else if strings.HasSuffix(t.Name(), "Get") {
+		return createGetInput(t)
+	} else if strings.HasSuffix(t.Name(), "Headers") {
+		return createValuesInput(t, internal.DecodeHeaders)
+	} else if strings.HasSuffix(t.Name(), "Cookies") {
+		return createValuesInput(t, internal.DecodeCookies)
+	} else if m, ok := formInputMethod(t); ok {
+		return createFormInput(t, m)
+	} else if t.Kind() == reflect.Ptr && strings.HasSuffix(t.Elem().Name(), "JSON") {
+		return createJSONInput(t, true)
+	} else if strings.HasSuffix(t.Name(), "JSON") {
+		return createJSONInput(t, false)
+	} else if t.Kind() == reflect.Ptr && strings.HasSuffix(t.Elem().Name(), "Body") {
+		return wo.createBodyInput(t, true)
+	} else if strings.HasSuffix(t.Name(), "Body") {
+		return wo.createBodyInput(t, false)
+	} else if t.Kind() == reflect.Ptr && internal.IsTagged(t.Elem()) {
+		return createTaggedInput(t, true)
+	} else if internal.IsTagged(t) {
+		return createTaggedInput(t, false)
 	}
+	return nil
 }
 
 // === Below are some functions that extract something from the http.Request and return a reflect.Value with that value.
@@ -206,28 +374,176 @@ func getResponseWriter(w http.ResponseWriter, r *http.Request) (reflect.Value, H
 	return reflect.ValueOf(w), nil
 }
 
+func getMultipartStream(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	s, err := internal.NewMultipartStream(r)
+	if err != nil {
+		return reflect.Value{}, genapi.DecodeFailed(err)
+	}
+	return reflect.ValueOf(s), nil
+}
+
+func getLastEventID(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	id, _ := internal.DecodeLastEventID(r)
+	return reflect.ValueOf(id), nil
+}
+
+func getPage(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	p, err := internal.DecodePage(r)
+	if err != nil {
+		return reflect.Value{}, genapi.DecodeFailed(err)
+	}
+	return reflect.ValueOf(p), nil
+}
+
+func getPatch(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	p, err := internal.DecodePatch(r)
+	if err != nil {
+		return reflect.Value{}, genapi.DecodeFailed(err)
+	}
+	return reflect.ValueOf(&p).Elem(), nil
+}
+
+func getMergePatch(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	p, err := internal.DecodeMergePatch(r)
+	if err != nil {
+		return reflect.Value{}, genapi.DecodeFailed(err)
+	}
+	return reflect.ValueOf(p), nil
+}
+
+func getJSONPatch(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	p, err := internal.DecodeJSONPatch(r)
+	if err != nil {
+		return reflect.Value{}, genapi.DecodeFailed(err)
+	}
+	return reflect.ValueOf(p), nil
+}
+
+func createJSONStream(t reflect.Type) func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	return func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+		v := reflect.New(t.Elem())
+		if err := v.Interface().(jsonStream).init(r); err != nil {
+			return reflect.Value{}, genapi.DecodeFailed(err)
+		}
+		return v, nil
+	}
+}
+
 func createGetInput(t reflect.Type) func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	checkValidation(t)
 	return func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
 		// TODO(quis): Consider putting v in a sync.Pool.
 		v := reflect.New(t)
-		if err := internal.DecodeGet(r, v.Interface()); err != nil {
-			return reflect.Value{}, respond.BadRequest(err.Error())
+		if hr := decodeGet(r, v.Interface()); hr != nil {
+			return reflect.Value{}, hr
 		}
 		return v.Elem(), nil
 	}
 }
 
-func createPostInput(pt reflect.Type) func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+// createValuesInput creates an extractor for an input struct (like FooHeaders) that is decoded with decode.
+func createValuesInput(t reflect.Type, decode func(r *http.Request, ret interface{}) error) func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	checkValidation(t)
+	return func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+		v := reflect.New(t)
+		if err := decode(r, v.Interface()); err != nil {
+			return reflect.Value{}, genapi.DecodeFailed(err)
+		}
+		if hr := validateInput(v.Interface()); hr != nil {
+			return reflect.Value{}, hr
+		}
+		return v.Elem(), nil
+	}
+}
+
+// formInputSuffixes maps suffixes of input types (like FooPut) that are decoded from a form in the request body to the method they're decoded for.
+// Form inputs are decoded for all of those methods.
+var formInputSuffixes = map[string]string{
+	"Post":   "POST",
+	"Put":    "PUT",
+	"Patch":  "PATCH",
+	"Delete": "DELETE",
+	"Form":   "",
+}
+
+// formInputMethod returns whether t is a form input and the method it's for, which is empty for ...Form inputs.
+func formInputMethod(t reflect.Type) (string, bool) {
+	if t.Kind() != reflect.Ptr {
+		return "", false
+	}
+	for suffix, m := range formInputSuffixes {
+		if strings.HasSuffix(t.Elem().Name(), suffix) {
+			return m, true
+		}
+	}
+	return "", false
+}
+
+// isFormMethod returns whether the body of requests with the given method is decoded for ...Form inputs.
+func isFormMethod(method string) bool {
+	switch method {
+	case "POST", "PUT", "PATCH", "DELETE":
+		return true
+	}
+	return false
+}
+
+// decodesForm returns whether a form input for method (as returned by formInputMethod) is decoded for a request with the given method.
+func decodesForm(method, requestMethod string) bool {
+	if method == "" {
+		return isFormMethod(requestMethod)
+	}
+	return requestMethod == method
+}
+
+// methodSet holds the methods for which a handler has method-specific form inputs (like FooPut).
+type methodSet map[string]bool
+
+// notAllowed returns a 405 response if the handler has ...Put, ...Patch or ...Delete inputs, but none for the method of r.
+// GET, HEAD and OPTIONS are always allowed. Only ...Post inputs don't restrict the methods, as handlers taking those were always called for any method.
+func (ms methodSet) notAllowed(r *http.Request) HttpResponse {
+	if !ms.restricted() || r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS" || ms[r.Method] {
+		return nil
+	}
+	return respond.WithHeader(respond.MethodNotAllowed(fmt.Sprintf("method %s not allowed", r.Method)), "Allow", ms.allow())
+}
+
+func (ms methodSet) restricted() bool {
+	for m := range ms {
+		if m != "POST" {
+			return true
+		}
+	}
+	return false
+}
+
+// allow returns the value for the Allow header of 405 responses.
+func (ms methodSet) allow() string {
+	allow := []string{"GET", "HEAD", "OPTIONS"}
+	for m := range ms {
+		allow = append(allow, m)
+	}
+	sort.Strings(allow[3:])
+	return strings.Join(allow, ", ")
+}
+
+// createFormInput creates an extractor for a pointer to a form input that is only decoded for the given method.
+// If method is empty, it's decoded for all methods in formInputSuffixes.
+func createFormInput(pt reflect.Type, method string) func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
 	nilptr := reflect.New(pt).Elem()
 	t := pt.Elem()
+	if err := internal.CheckFiles(t); err != nil {
+		panic(fmt.Errorf("convreq: %v", err))
+	}
+	checkValidation(t)
 	return func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
-		if r.Method != "POST" {
+		if !decodesForm(method, r.Method) {
 			return nilptr, nil
 		}
 		// TODO(quis): Consider putting v in a sync.Pool.
 		v := reflect.New(t)
-		if err := internal.DecodePost(r, v.Interface()); err != nil {
-			return reflect.Value{}, respond.BadRequest(err.Error())
+		if hr := decodeForm(r, v.Interface()); hr != nil {
+			return reflect.Value{}, hr
 		}
 		return v, nil
 	}
@@ -238,10 +554,11 @@ func createJSONInput(pt reflect.Type, isPtr bool) func(w http.ResponseWriter, r
 	if isPtr {
 		t = pt.Elem()
 	}
+	checkValidation(t)
 	return func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
 		v := reflect.New(t)
-		if err := internal.DecodeJSON(r, v.Interface()); err != nil {
-			return reflect.Value{}, respond.BadRequest(err.Error())
+		if hr := decodeJSON(r, v.Interface()); hr != nil {
+			return reflect.Value{}, hr
 		}
 		if isPtr {
 			return v, nil
@@ -250,9 +567,137 @@ func createJSONInput(pt reflect.Type, isPtr bool) func(w http.ResponseWriter, r
 	}
 }
 
+// createBodyInput creates an extractor for a ...Body input, which is decoded by the BodyDecoder for the Content-Type of the request.
+func (wo *wrapOptions) createBodyInput(pt reflect.Type, isPtr bool) func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	t := pt
+	if isPtr {
+		t = pt.Elem()
+	}
+	checkValidation(t)
+	decoders := wo.bodyDecoders
+	return func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+		v := reflect.New(t)
+		if hr := decodeBody(r, v.Interface(), decoders); hr != nil {
+			return reflect.Value{}, hr
+		}
+		if isPtr {
+			return v, nil
+		}
+		return v.Elem(), nil
+	}
+}
+
+func createTaggedInput(pt reflect.Type, isPtr bool) func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+	t := pt
+	if isPtr {
+		t = pt.Elem()
+	}
+	if err := internal.CheckTagged(t); err != nil {
+		panic(fmt.Errorf("convreq: %v", err))
+	}
+	checkValidation(t)
+	return func(w http.ResponseWriter, r *http.Request) (reflect.Value, HttpResponse) {
+		v := reflect.New(t)
+		if hr := decodeTagged(r, v.Interface()); hr != nil {
+			return reflect.Value{}, hr
+		}
+		if isPtr {
+			return v, nil
+		}
+		return v.Elem(), nil
+	}
+}
+
+// === Below are the functions that decode and validate input into v, which is a pointer. They return a HttpResponse if that failed.
+// === Decoding errors are turned into responses by genapi.DecodeFailed, so the codegen dispatcher responds the same way.
+
+func decodeGet(r *http.Request, v interface{}) HttpResponse {
+	if err := internal.DecodeGet(r, v); err != nil {
+		return genapi.DecodeFailed(err)
+	}
+	return validateInput(v)
+}
+
+func decodeForm(r *http.Request, v interface{}) HttpResponse {
+	if err := internal.DecodeForm(r, v); err != nil {
+		return genapi.DecodeFailed(err)
+	}
+	return validateInput(v)
+}
+
+func decodeJSON(r *http.Request, v interface{}) HttpResponse {
+	if err := internal.DecodeJSON(r, v); err != nil {
+		return genapi.DecodeFailed(err)
+	}
+	return validateInput(v)
+}
+
+func decodeBody(r *http.Request, v interface{}, decoders map[string]BodyDecoder) HttpResponse {
+	if err := internal.DecodeBody(r, v, decoders); err != nil {
+		return genapi.DecodeFailed(err)
+	}
+	return validateInput(v)
+}
+
+func decodeTagged(r *http.Request, v interface{}) HttpResponse {
+	if err := internal.DecodeTagged(r, v); err != nil {
+		return genapi.DecodeFailed(err)
+	}
+	return validateInput(v)
+}
+
+// checkValidation panics if the `validate` tags of t are invalid.
+func checkValidation(t reflect.Type) {
+	if err := internal.CheckValidation(t); err != nil {
+		panic(fmt.Errorf("convreq: %v", err))
+	}
+}
+
+// validateInput validates the decoded input that v points to and returns a 422 response if it's invalid.
+func validateInput(v interface{}) HttpResponse {
+	if errs := internal.Validate(v); errs != nil {
+		return respond.UnprocessableEntity(errs.Error(), errs...)
+	}
+	return nil
+}
+
 // === Below are some functions that can handle the return value of a request handler.
 
-func handleVoid(w http.ResponseWriter, r *http.Request) {
+func handleVoid(w http.ResponseWriter, r *http.Request, outs []reflect.Value) {
+}
+
+// callHandler returns a function that passes the return values to a handler from the handlers map.
+func callHandler(h reflect.Value) func(w http.ResponseWriter, r *http.Request, outs []reflect.Value) {
+	return func(w http.ResponseWriter, r *http.Request, outs []reflect.Value) {
+		h.Call(append([]reflect.Value{reflect.ValueOf(w), reflect.ValueOf(r)}, outs...))
+	}
+}
+
+// createValueErrorHandler returns a function that handles the return values (T, error), where t is T.
+func (wo *wrapOptions) createValueErrorHandler(t reflect.Type) func(w http.ResponseWriter, r *http.Request, outs []reflect.Value) {
+	var render func(w http.ResponseWriter, r *http.Request, v reflect.Value)
+	if h, ok := wo.handlers[t]; ok {
+		render = func(w http.ResponseWriter, r *http.Request, v reflect.Value) {
+			h.Call([]reflect.Value{reflect.ValueOf(w), reflect.ValueOf(r), v})
+		}
+	} else if t.Implements(httpResponseType) {
+		render = func(w http.ResponseWriter, r *http.Request, v reflect.Value) {
+			hr, _ := v.Interface().(HttpResponse)
+			internal.DoRespond(w, r, hr)
+		}
+	} else {
+		renderer := wo.renderer
+		render = func(w http.ResponseWriter, r *http.Request, v reflect.Value) {
+			internal.DoRespond(w, r, renderer(v.Interface()))
+		}
+	}
+	return func(w http.ResponseWriter, r *http.Request, outs []reflect.Value) {
+		if err, _ := outs[1].Interface().(error); err != nil {
+			handleError(w, r, err)
+			return
+		}
+		render(w, r, outs[0])
+	}
 }
 
 func handleError(w http.ResponseWriter, r *http.Request, err error) {
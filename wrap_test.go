@@ -15,15 +15,21 @@
 package convreq_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/Jille/convreq"
 	"github.com/Jille/convreq/respond"
+	"github.com/gorilla/mux"
 )
 
 type myStruct struct{}
@@ -106,3 +112,511 @@ func TestWithErrorHandler(t *testing.T) {
 		t.Errorf("got code %d; want %d", respRecorder.Code, 501)
 	}
 }
+
+func TestPanic(t *testing.T) {
+	panicker := func(w http.ResponseWriter, r *http.Request) (reflect.Value, convreq.HttpResponse) {
+		panic("extractor")
+	}
+	tests := []struct {
+		name    string
+		handler interface{}
+		opts    []convreq.WrapOption
+	}{
+		{
+			name: "fast path",
+			handler: func(ctx context.Context, r *http.Request) convreq.HttpResponse {
+				panic("handler")
+			},
+		},
+		{
+			name: "reflect path",
+			handler: func() error {
+				panic("handler")
+			},
+		},
+		{
+			name:    "extractor",
+			handler: func(ms myStruct) {},
+			opts:    []convreq.WrapOption{convreq.WithParameterType(reflect.TypeOf(myStruct{}), panicker)},
+		},
+		{
+			name:    "return value handler",
+			handler: func() int { return 204 },
+			opts: []convreq.WrapOption{convreq.WithReturnType(reflect.TypeOf(204), func(w http.ResponseWriter, r *http.Request, code int) {
+				panic("return value handler")
+			})},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			var handler http.Handler = convreq.Wrap(tc.handler, tc.opts...)
+			handler.ServeHTTP(respRecorder, httptest.NewRequest("GET", "/", nil))
+			if respRecorder.Code != 500 {
+				t.Errorf("got code %d; want %d", respRecorder.Code, 500)
+			}
+
+			var got interface{}
+			ph := func(r *http.Request, p interface{}) convreq.HttpResponse {
+				got = p
+				return respond.ServiceUnavailable("oops")
+			}
+			respRecorder = httptest.NewRecorder()
+			handler = convreq.Wrap(tc.handler, append(tc.opts, convreq.WithPanicHandler(ph))...)
+			handler.ServeHTTP(respRecorder, httptest.NewRequest("GET", "/", nil))
+			if respRecorder.Code != 503 {
+				t.Errorf("got code %d; want %d", respRecorder.Code, 503)
+			}
+			if got == nil {
+				t.Errorf("PanicHandler wasn't called")
+			}
+		})
+	}
+}
+
+func TestWithDefaultRenderer(t *testing.T) {
+	respRecorder := httptest.NewRecorder()
+	h := func() (int, error) { return 7, nil }
+	var handler http.Handler = convreq.Wrap(h, convreq.WithDefaultRenderer(func(data interface{}) convreq.HttpResponse {
+		return respond.Printf("%v is a number", data)
+	}))
+	handler.ServeHTTP(respRecorder, httptest.NewRequest("GET", "/", nil))
+	if got, want := respRecorder.Body.String(), "7 is a number"; got != want {
+		t.Errorf("got body %q; want %q", got, want)
+	}
+}
+
+type nilResponse struct{}
+
+func (*nilResponse) Respond(w http.ResponseWriter, r *http.Request) error {
+	return respond.String("not nil").Respond(w, r)
+}
+
+func TestNilPointerResponse(t *testing.T) {
+	handlers := map[string]http.Handler{
+		"Wrap":            convreq.Wrap(func() (*nilResponse, error) { return nil, nil }),
+		"HandleGetResult": convreq.HandleGetResult(func(ctx context.Context, r *http.Request, get struct{}) (*nilResponse, error) { return nil, nil }),
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, httptest.NewRequest("GET", "/", nil))
+			if respRecorder.Code != 200 || respRecorder.Body.Len() != 0 {
+				t.Errorf("got code %d and body %q; want an empty 200", respRecorder.Code, respRecorder.Body.String())
+			}
+		})
+	}
+}
+
+type itemPut struct {
+	Name string `schema:"name"`
+}
+
+type itemPost struct {
+	Name string `schema:"name"`
+}
+
+type itemDelete struct {
+	Reason string `schema:"reason"`
+}
+
+type itemForm struct {
+	Name string `schema:"name"`
+}
+
+func TestFormMethods(t *testing.T) {
+	item := convreq.Wrap(func(put *itemPut, del *itemDelete) convreq.HttpResponse {
+		switch {
+		case put != nil:
+			return respond.String("put " + put.Name)
+		case del != nil:
+			return respond.String("delete " + del.Reason)
+		}
+		return respond.String("get")
+	})
+	form := convreq.Wrap(func(f *itemForm) convreq.HttpResponse {
+		if f == nil {
+			return respond.String("no form")
+		}
+		return respond.String("form " + f.Name)
+	})
+	post := convreq.Wrap(func(r *http.Request, p *itemPost) convreq.HttpResponse {
+		if p == nil {
+			return respond.String("no post for " + r.Method)
+		}
+		return respond.String("post " + p.Name)
+	})
+	genericDelete := convreq.HandlePost(func(ctx context.Context, r *http.Request, d *itemDelete) convreq.HttpResponse {
+		if d == nil {
+			return respond.String("no delete")
+		}
+		return respond.String(r.Method + " " + d.Reason)
+	})
+	tests := []struct {
+		name      string
+		handler   http.Handler
+		method    string
+		body      string
+		wantCode  int
+		wantBody  string
+		wantAllow string
+	}{
+		{name: "GET", handler: item, method: "GET", wantCode: 200, wantBody: "get"},
+		{name: "PUT", handler: item, method: "PUT", body: "name=dude", wantCode: 200, wantBody: "put dude"},
+		{name: "DELETE", handler: item, method: "DELETE", body: "reason=old", wantCode: 200, wantBody: "delete old"},
+		{name: "POST", handler: item, method: "POST", body: "name=dude", wantCode: 405, wantBody: "method POST not allowed\n", wantAllow: "GET, HEAD, OPTIONS, DELETE, PUT"},
+		{name: "OPTIONS", handler: item, method: "OPTIONS", wantCode: 200, wantBody: "get"},
+		{name: "Form GET", handler: form, method: "GET", wantCode: 200, wantBody: "no form"},
+		{name: "Form PATCH", handler: form, method: "PATCH", body: "name=dude", wantCode: 200, wantBody: "form dude"},
+		{name: "Post POST", handler: post, method: "POST", body: "name=dude", wantCode: 200, wantBody: "post dude"},
+		{name: "Post PUT", handler: post, method: "PUT", body: "name=dude", wantCode: 200, wantBody: "no post for PUT"},
+		{name: "HandlePost DELETE", handler: genericDelete, method: "DELETE", body: "reason=old", wantCode: 200, wantBody: "DELETE old"},
+		{name: "HandlePost GET", handler: genericDelete, method: "GET", wantCode: 200, wantBody: "no delete"},
+		{name: "HandlePost POST", handler: genericDelete, method: "POST", wantCode: 405, wantBody: "method POST not allowed\n", wantAllow: "GET, HEAD, OPTIONS, DELETE"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			respRecorder := httptest.NewRecorder()
+			tc.handler.ServeHTTP(respRecorder, req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+			if got := respRecorder.Header().Get("Allow"); got != tc.wantAllow {
+				t.Errorf("got Allow header %q; want %q", got, tc.wantAllow)
+			}
+		})
+	}
+}
+
+type itemBody struct {
+	Name string `json:"name" xml:"name" schema:"name"`
+}
+
+func TestBodyInput(t *testing.T) {
+	handler := convreq.Wrap(func(b *itemBody) convreq.HttpResponse {
+		return respond.String(b.Name)
+	}, convreq.WithBodyDecoder("text/plain", func(r *http.Request, ret interface{}) error {
+		b, err := io.ReadAll(r.Body)
+		ret.(*itemBody).Name = string(b)
+		return err
+	}))
+	tests := []struct {
+		contentType string
+		body        string
+		wantCode    int
+		wantBody    string
+	}{
+		{contentType: "application/json; charset=utf-8", body: `{"name": "dude"}`, wantCode: 200, wantBody: "dude"},
+		{contentType: "application/merge-patch+json", body: `{"name": "dude"}`, wantCode: 200, wantBody: "dude"},
+		{contentType: "application/xml", body: `<item><name>dude</name></item>`, wantCode: 200, wantBody: "dude"},
+		{contentType: "application/x-www-form-urlencoded", body: "name=dude", wantCode: 200, wantBody: "dude"},
+		{contentType: "text/plain", body: "dude", wantCode: 200, wantBody: "dude"},
+		{contentType: "application/json", body: `{"name": `, wantCode: 400, wantBody: "failed to parse json: unexpected EOF\n"},
+		{contentType: "image/png", wantCode: 415, wantBody: "expected Content-Type: application/json, application/x-www-form-urlencoded, application/xml, multipart/form-data, text/json, text/plain, text/xml rather than \"image/png\"\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.contentType, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			respRecorder := httptest.NewRecorder()
+			handler.ServeHTTP(respRecorder, req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
+
+type smallBody struct {
+	Name string `json:"name" schema:"name"`
+}
+
+func (smallBody) MaxBodySize() int64 {
+	return 16
+}
+
+// multipartFile returns a multipart/form-data body with boundary "b" and a single file.
+func multipartFile(contents string) string {
+	return "--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\n" + contents + "\r\n--b--\r\n"
+}
+
+func TestBodyLimits(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	tests := []struct {
+		name        string
+		handler     http.Handler
+		contentType string
+		encoding    string
+		body        string
+		wantCode    int
+	}{
+		{
+			name:        "JSON within limit",
+			handler:     convreq.Wrap(func(b *itemBody) {}, convreq.WithMaxBodySize(200)),
+			contentType: "application/json",
+			body:        `{"name": "` + long + `"}`,
+			wantCode:    200,
+		},
+		{
+			name:        "JSON too large",
+			handler:     convreq.Wrap(func(b *itemBody) {}, convreq.WithMaxBodySize(50)),
+			contentType: "application/json",
+			body:        `{"name": "` + long + `"}`,
+			wantCode:    413,
+		},
+		{
+			name:        "form too large",
+			handler:     convreq.Wrap(func(f *itemForm) {}, convreq.WithMaxBodySize(50)),
+			contentType: "application/x-www-form-urlencoded",
+			body:        "name=" + long,
+			wantCode:    413,
+		},
+		{
+			name:        "type override",
+			handler:     convreq.Wrap(func(b *smallBody) {}),
+			contentType: "application/json",
+			body:        `{"name": "` + long + `"}`,
+			wantCode:    413,
+		},
+		{
+			name:        "multipart within default limit",
+			handler:     convreq.Wrap(func(f *itemForm) {}),
+			contentType: "multipart/form-data; boundary=b",
+			body:        multipartFile(strings.Repeat("x", 11<<20)),
+			wantCode:    200,
+		},
+		{
+			name:        "multipart too large",
+			handler:     convreq.Wrap(func(f *itemForm) {}, convreq.WithMaxMultipartSize(100)),
+			contentType: "multipart/form-data; boundary=b",
+			body:        multipartFile(long),
+			wantCode:    413,
+		},
+		{
+			name:        "unlimited",
+			handler:     convreq.Wrap(func(b *itemBody) {}, convreq.WithMaxBodySize(-1)),
+			contentType: "application/json",
+			body:        `{"name": "` + strings.Repeat("x", 11<<20) + `"}`,
+			wantCode:    200,
+		},
+		{
+			name:        "unlimited multipart zip bomb",
+			handler:     convreq.Wrap(func(f *itemForm) {}, convreq.WithMaxMultipartSize(-1)),
+			contentType: "multipart/form-data; boundary=b",
+			encoding:    "gzip",
+			body:        compress(t, "gzip", multipartFile(strings.Repeat("x", 11<<20))),
+			wantCode:    413,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.encoding != "" {
+				req.Header.Set("Content-Encoding", tc.encoding)
+			}
+			respRecorder := httptest.NewRecorder()
+			tc.handler.ServeHTTP(respRecorder, req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d (%s)", respRecorder.Code, tc.wantCode, respRecorder.Body.String())
+			}
+		})
+	}
+}
+
+func compress(t *testing.T, encoding, s string) string {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+	if _, err := io.WriteString(w, s); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestContentEncoding(t *testing.T) {
+	body := convreq.Wrap(func(b *itemBody) convreq.HttpResponse {
+		return respond.String(b.Name)
+	}, convreq.WithMaxBodySize(1000))
+	bomb := `{"name": "` + strings.Repeat("x", 10000) + `"}`
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+		wantCode    int
+		wantBody    string
+	}{
+		{
+			name:        "gzip JSON",
+			contentType: "application/json",
+			encoding:    "gzip",
+			body:        compress(t, "gzip", `{"name": "dude"}`),
+			wantCode:    200,
+			wantBody:    "dude",
+		},
+		{
+			name:        "deflate form",
+			contentType: "application/x-www-form-urlencoded",
+			encoding:    "deflate",
+			body:        compress(t, "deflate", "name=dude"),
+			wantCode:    200,
+			wantBody:    "dude",
+		},
+		{
+			name:        "gzip then deflate",
+			contentType: "application/json",
+			encoding:    "gzip, deflate",
+			body:        compress(t, "deflate", compress(t, "gzip", `{"name": "dude"}`)),
+			wantCode:    200,
+			wantBody:    "dude",
+		},
+		{
+			name:        "zip bomb",
+			contentType: "application/json",
+			encoding:    "gzip",
+			body:        compress(t, "gzip", bomb),
+			wantCode:    413,
+			wantBody:    "request body too large; the limit is 1000 bytes\n",
+		},
+		{
+			name:        "not gzipped",
+			contentType: "application/json",
+			encoding:    "gzip",
+			body:        `{"name": "dude"}`,
+			wantCode:    400,
+			wantBody:    "failed to parse json: gzip: invalid header\n",
+		},
+		{
+			name:        "unsupported encoding",
+			contentType: "application/json",
+			encoding:    "br",
+			body:        `{"name": "dude"}`,
+			wantCode:    415,
+			wantBody:    "unsupported Content-Encoding \"br\"; supported are gzip, deflate\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			req.Header.Set("Content-Encoding", tc.encoding)
+			respRecorder := httptest.NewRecorder()
+			body.ServeHTTP(respRecorder, req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}
+
+type pagingGet struct {
+	Page  int  `schema:"page"`
+	Limit int  `schema:"limit"`
+	Desc  bool `schema:"desc"`
+}
+
+func TestWithDecodeErrorHandler(t *testing.T) {
+	handler := convreq.Wrap(func(get pagingGet) {}, convreq.WithDecodeErrorHandler(func(r *http.Request, errs convreq.DecodeErrors) convreq.HttpResponse {
+		return respond.JSON(errs)
+	}))
+	respRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(respRecorder, httptest.NewRequest("GET", "/?page=one&limit=10&desc=maybe", nil))
+	want := `[{"source":"query","field":"desc","value":"maybe","reason":"cannot convert \"maybe\" to bool"},{"source":"query","field":"page","value":"one","reason":"cannot convert \"one\" to int"}]` + "\n"
+	if got := respRecorder.Body.String(); got != want {
+		t.Errorf("got body %q; want %q", got, want)
+	}
+}
+
+type strictGet struct {
+	Page int `schema:"page"`
+}
+
+func (strictGet) StrictDecoding() bool {
+	return true
+}
+
+func TestStrictDecoding(t *testing.T) {
+	strict := convreq.WithStrictDecoding()
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		req      *http.Request
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "lenient",
+			handler:  convreq.Wrap(func(get pagingGet) {}),
+			req:      httptest.NewRequest("GET", "/?pgae=1", nil),
+			wantCode: 200,
+		},
+		{
+			name:     "query",
+			handler:  convreq.Wrap(func(get pagingGet) {}, strict),
+			req:      httptest.NewRequest("GET", "/?pgae=1&limit=5", nil),
+			wantCode: 400,
+			wantBody: "failed to parse query: pgae: is not a known field\n",
+		},
+		{
+			name:     "path variables",
+			handler:  convreq.Wrap(func(get pagingGet) {}, strict),
+			req:      mux.SetURLVars(httptest.NewRequest("GET", "/?page=1", nil), map[string]string{"id": "7"}),
+			wantCode: 200,
+		},
+		{
+			name:     "form",
+			handler:  convreq.Wrap(func(f *itemForm) {}, strict),
+			req:      formRequest(httptest.NewRequest("POST", "/", strings.NewReader("name=dude&nmae=dude"))),
+			wantCode: 400,
+			wantBody: "failed to parse form: nmae: is not a known field\n",
+		},
+		{
+			name:     "JSON",
+			handler:  convreq.Wrap(func(b *itemBody) {}, strict),
+			req:      jsonRequest(httptest.NewRequest("POST", "/", strings.NewReader(`{"nmae": "dude"}`))),
+			wantCode: 400,
+			wantBody: "failed to parse json: nmae: is not a known field\n",
+		},
+		{
+			name:     "type override",
+			handler:  convreq.Wrap(func(get strictGet) {}),
+			req:      httptest.NewRequest("GET", "/?pgae=1", nil),
+			wantCode: 400,
+			wantBody: "failed to parse query: pgae: is not a known field\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			respRecorder := httptest.NewRecorder()
+			tc.handler.ServeHTTP(respRecorder, tc.req)
+			if respRecorder.Code != tc.wantCode {
+				t.Errorf("got code %d; want %d", respRecorder.Code, tc.wantCode)
+			}
+			if got := respRecorder.Body.String(); got != tc.wantBody {
+				t.Errorf("got body %q; want %q", got, tc.wantBody)
+			}
+		})
+	}
+}